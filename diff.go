@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/snapshot"
+)
+
+// runDiff reports how compliance state changed between two snapshots, returning the exit code
+func runDiff(args []string) int {
+	if len(args) != 2 {
+		log.Printf("usage: diff <old.json> <new.json> (flags must precede the paths)")
+		return exitUsage
+	}
+
+	older, err := snapshot.Read(args[0])
+	if err != nil {
+		log.Printf("read: %v", err)
+		return exitFailure
+	}
+	newer, err := snapshot.Read(args[1])
+	if err != nil {
+		log.Printf("read: %v", err)
+		return exitFailure
+	}
+
+	d := snapshot.Compare(older, newer)
+	if *outputFlag == "json" {
+		return printJSON(d)
+	}
+	fmt.Print(d.Markdown())
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/snapshot"
+)
+
+// runExport writes the fully detailed tests that a sync would use to a snapshot file, returning the exit code
+func runExport(ctx context.Context, hc *http.Client, args []string) int {
+	if len(args) != 1 {
+		log.Printf("usage: export <snapshot.json> (flags must precede the path)")
+		return exitUsage
+	}
+	path := args[0]
+
+	src, err := newSource(hc, nil)
+	if err != nil {
+		log.Printf("source: %v", err)
+		return exitUsage
+	}
+
+	reportKeys := selectedReports()
+	tests, err := src.GetTests(ctx, reportKeys)
+	if err != nil {
+		log.Printf("Secureframe test query failed: %v", err)
+		return exitCode(err)
+	}
+
+	if err := snapshot.New(*companyIDFlag, reportKeys, tests).Write(path); err != nil {
+		log.Printf("write snapshot: %v", err)
+		return exitFailure
+	}
+	log.Printf("exported %d tests to %s", len(tests), path)
+	return 0
+}
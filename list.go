@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// frameworkSummary is a framework seen in the test listing, along with how many tests apply to it
+type frameworkSummary struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	TagLabel string `json:"tagLabel"`
+	Tests    int    `json:"tests"`
+	Failing  int    `json:"failing"`
+}
+
+// testSummary is a single row of list-tests output
+type testSummary struct {
+	ID         string   `json:"id"`
+	Key        string   `json:"key"`
+	Title      string   `json:"title"`
+	Pass       bool     `json:"pass"`
+	Enabled    bool     `json:"enabled"`
+	Domain     string   `json:"domain"`
+	Frameworks []string `json:"frameworks"`
+}
+
+// runListFrameworks prints every framework that tests apply to, returning the exit code.
+// Report keys are ignored, as the point is to discover them.
+func runListFrameworks(ctx context.Context, hc *http.Client) int {
+	src, err := newSource(hc, nil)
+	if err != nil {
+		log.Printf("source: %v", err)
+		return exitUsage
+	}
+
+	tests, err := src.ListTests(ctx, nil)
+	if err != nil {
+		log.Printf("list tests: %v", err)
+		return exitCode(err)
+	}
+
+	byKey := map[string]*frameworkSummary{}
+	for _, t := range tests {
+		for _, f := range t.Frameworks(nil) {
+			s := byKey[f.Key]
+			if s == nil {
+				s = &frameworkSummary{Key: f.Key, Name: f.Name, TagLabel: f.TagLabel}
+				byKey[f.Key] = s
+			}
+			s.Tests++
+			if !t.Pass && t.Enabled {
+				s.Failing++
+			}
+		}
+	}
+
+	summaries := []frameworkSummary{}
+	for _, s := range byKey {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+
+	if *outputFlag == "json" {
+		return printJSON(summaries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tNAME\tLABEL\tTESTS\tFAILING")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", s.Key, s.Name, s.TagLabel, s.Tests, s.Failing)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush: %v", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// runListTests prints the tests that a sync would consider, returning the exit code
+func runListTests(ctx context.Context, hc *http.Client) int {
+	src, err := newSource(hc, nil)
+	if err != nil {
+		log.Printf("source: %v", err)
+		return exitUsage
+	}
+
+	reportKeys := selectedReports()
+	tests, err := src.ListTests(ctx, reportKeys)
+	if err != nil {
+		log.Printf("list tests: %v", err)
+		return exitCode(err)
+	}
+
+	summaries := []testSummary{}
+	for _, t := range tests {
+		s := testSummary{
+			ID:         t.ID,
+			Key:        t.V2.Key,
+			Title:      t.V2.Title,
+			Pass:       t.Pass,
+			Enabled:    t.Enabled,
+			Domain:     t.V2.TestDomain,
+			Frameworks: []string{},
+		}
+		for _, f := range t.Frameworks(reportKeys) {
+			s.Frameworks = append(s.Frameworks, f.Key)
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+
+	if *outputFlag == "json" {
+		return printJSON(summaries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKEY\tPASS\tENABLED\tDOMAIN\tFRAMEWORKS\tTITLE")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%s\t%s\t%s\n", s.ID, s.Key, s.Pass, s.Enabled, s.Domain, strings.Join(s.Frameworks, ","), s.Title)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("flush: %v", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// printJSON prints v to stdout as indented JSON, returning the exit code
+func printJSON(v interface{}) int {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Printf("marshal: %v", err)
+		return exitFailure
+	}
+	fmt.Println(string(bs))
+	return 0
+}
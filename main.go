@@ -3,19 +3,23 @@ package main
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/cassette"
 	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
 	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/snapshot"
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/sync"
 	"github.com/danott/envflag"
-	"golang.org/x/oauth2"
-
 	"github.com/google/go-github/v44/github"
+	"golang.org/x/oauth2"
 )
 
 var (
@@ -23,20 +27,132 @@ var (
 	githubTokenFlag     = flag.String("github-token", "", "github token")
 	dryRunFlag          = flag.Bool("dry-run", false, "dry-run mode")
 	sfTokenFlag         = flag.String("secureframe-token", "", "Secureframe bearer token")
-	reportKeyFlag       = flag.String("report-key", "soc2_alpha", "report key to filter by")
+	sfEndpointFlag      = flag.String("secureframe-endpoint", secureframe.DefaultEndpoint, "Secureframe GraphQL endpoint")
+	sfRESTEndpointFlag  = flag.String("secureframe-rest-endpoint", secureframe.DefaultRESTEndpoint, "Secureframe REST API endpoint")
+	sourceFlag          = flag.String("source", "graphql", "Secureframe backend to use: graphql (undocumented), rest (public API), or file:<path> (a snapshot written by export)")
+	sfConcurrencyFlag   = flag.Int("secureframe-concurrency", secureframe.DefaultConcurrency, "number of Secureframe detail requests to make in parallel")
+	sfBatchSizeFlag     = flag.Int("secureframe-batch-size", secureframe.DefaultBatchSize, "number of Secureframe test details to fetch per request")
+	sfRateFlag          = flag.Float64("secureframe-rate", secureframe.DefaultRequestsPerSecond, "maximum Secureframe requests per second")
+	sfMaxAttemptsFlag   = flag.Int("secureframe-max-attempts", secureframe.DefaultRetryPolicy.MaxAttempts, "maximum attempts per Secureframe request")
+	reportKeyFlag       = flag.String("report-key", "soc2_alpha", "report key to filter by (deprecated: use --reports)")
+	reportsFlag         = flag.String("reports", "", "comma-separated list of report keys to filter by, such as soc2_alpha,iso27001")
+	workspaceIDFlag     = flag.String("workspace-id", "", "Secureframe workspace ID to scope tests to")
+	workspaceNameFlag   = flag.String("workspace-name", "", "name of the Secureframe workspace, for issue labels and metadata (default: --workspace-id)")
+	companyFwIDFlag     = flag.String("company-framework-id", "", "Secureframe company framework ID to scope tests to")
 	companyIDFlag       = flag.String("company", "079b854c-c53a-4c71-bfb8-f9e87b13b6c4", "secureframe company user ID")
 	githubRepoFlag      = flag.String("github-repo", "chainguard-dev/secureframe", "github repo to open issues against")
 	githubLabelFlag     = flag.String("github-label", "", "additional github label to apply")
-
-	idRE         = regexp.MustCompile(`Secureframe ID: ([\w-]+)`)
-	sleepMS      = 250
-	maxSleepTime = 5 * time.Second
+	includeDomainsFlag  = flag.String("include-domains", "", "comma-separated test domain patterns to include, such as cloud*")
+	excludeDomainsFlag  = flag.String("exclude-domains", "", "comma-separated test domain patterns to exclude")
+	includeFuncsFlag    = flag.String("include-functions", "", "comma-separated test function patterns to include")
+	excludeFuncsFlag    = flag.String("exclude-functions", "", "comma-separated test function patterns to exclude")
+	includeTypesFlag    = flag.String("include-types", "", "comma-separated test type patterns to include")
+	excludeTypesFlag    = flag.String("exclude-types", "", "comma-separated test type patterns to exclude")
+	includeCatsFlag     = flag.String("include-resource-categories", "", "comma-separated resource category patterns to include")
+	excludeCatsFlag     = flag.String("exclude-resource-categories", "", "comma-separated resource category patterns to exclude")
+	includeTagsFlag     = flag.String("include-tags", "", "comma-separated test tag patterns to include")
+	excludeTagsFlag     = flag.String("exclude-tags", "", "comma-separated test tag patterns to exclude")
+	includeOwnersFlag   = flag.String("include-owners", "", "comma-separated test owner name or ID patterns to include")
+	excludeOwnersFlag   = flag.String("exclude-owners", "", "comma-separated test owner name or ID patterns to exclude")
+	includeKeysFlag     = flag.String("include-keys", "", "comma-separated test key patterns to include")
+	excludeKeysFlag     = flag.String("exclude-keys", "", "comma-separated test key patterns to exclude")
+	discoveryFlag       = flag.String("discovery", "search", "how to find managed issues that lost their label: none, search (GitHub search for the issue body), or full (list every issue, also matching titles); with --state-file, runs once per --full-refresh-interval, but always searches before creating issues")
+	closeExcludedFlag   = flag.Bool("close-excluded", false, "close issues for tests that still exist but are excluded by --include-*/--exclude-* or --company-framework-id, rather than leaving them alone")
+	canonicalFlag       = flag.String("duplicate-canonical", "oldest", "which of several open issues for the same test to keep: oldest, or most-active (most comments)")
+	recordFlag          = flag.String("record", "", "directory to record Secureframe and GitHub HTTP traffic to")
+	replayFlag          = flag.String("replay", "", "directory to replay Secureframe and GitHub HTTP traffic from, instead of the network")
+	stateFileFlag       = flag.String("state-file", "", "path to a file that tracks test fingerprints between runs, allowing unchanged tests to be skipped")
+	fullRefreshFlag     = flag.Duration("full-refresh-interval", secureframe.DefaultFullRefreshInterval, "how often to fetch every failing test when using --state-file")
+	cacheDirFlag        = flag.String("cache-dir", "", "directory to cache Secureframe test details in while iterating locally, such as on the issue template (default: no cache)")
+	cacheTTLFlag        = flag.Duration("cache-ttl", secureframe.DefaultCacheTTL, "how long cached Secureframe test details are used for")
+	noCacheFlag         = flag.Bool("no-cache", false, "bypass the cache for this run, even if --cache-dir or CACHE_DIR is set")
+	outputFlag          = flag.String("output", "text", "output format for commands that print results: text or json")
+	expectedShapeFlag   = flag.String("expected-shape", "", "check-schema: path to expected response shapes (default: built-in)")
+	schemaSnapshotFlag  = flag.String("schema-snapshot", "", "check-schema: path to an introspection snapshot to compare against")
+	updateSnapshotFlag  = flag.Bool("update-schema-snapshot", false, "check-schema: overwrite the introspection snapshot with the current schema")
 )
 
 func main() {
 	flag.Parse()
+
+	cmd := "sync"
+	args := flag.Args()
+	if len(args) > 0 {
+		cmd = args[0]
+		// Flags may also follow the command
+		_ = flag.CommandLine.Parse(args[1:])
+	}
 	envflag.Parse()
 
+	hc, err := newHTTPClient()
+	if err != nil {
+		log.Panicf("http client: %v", err)
+	}
+
+	ctx := context.Background()
+	switch cmd {
+	case "sync":
+		runSync(ctx, hc)
+	case "check-schema":
+		os.Exit(runCheckSchema(ctx, hc))
+	case "cache":
+		os.Exit(runCache(flag.Args()))
+	case "list-frameworks":
+		os.Exit(runListFrameworks(ctx, hc))
+	case "list-tests":
+		os.Exit(runListTests(ctx, hc))
+	case "export":
+		os.Exit(runExport(ctx, hc, flag.Args()))
+	case "diff":
+		os.Exit(runDiff(flag.Args()))
+	case "plan":
+		os.Exit(runPlan(ctx, hc, flag.Args()))
+	case "apply":
+		os.Exit(runApply(ctx, hc, flag.Args()))
+	default:
+		log.Printf("unknown command: %q (expected sync, check-schema, cache, list-frameworks, list-tests, export, diff, plan or apply)", cmd)
+		os.Exit(exitUsage)
+	}
+}
+
+// runSync syncs Secureframe tests to GitHub issues
+func runSync(ctx context.Context, hc *http.Client) {
+	gc, hasToken := newGitHubClient(ctx, hc)
+	if !hasToken {
+		log.Printf("github-token is empty: skipping github calls")
+	}
+
+	plan, src, err := planSync(ctx, hc, gc, hasToken)
+	if err != nil {
+		log.Printf("plan: %v", err)
+		os.Exit(exitCode(err))
+	}
+	if plan == nil {
+		os.Exit(0)
+	}
+
+	if err := applyPlan(ctx, gc, plan); err != nil {
+		log.Panicf("apply: %v", err)
+	}
+
+	// Only persist state once the sync has succeeded, so that a failed run is retried in full. Dry runs
+	// persist nothing, as the next run would otherwise skip discovering the issues that they did not relabel.
+	if sc, ok := src.(*secureframe.Client); ok && sc.State != nil && !*dryRunFlag {
+		if err := sc.State.Save(*stateFileFlag); err != nil {
+			log.Panicf("save state: %v", err)
+		}
+	}
+
+	log.Printf("%d issues created", plan.Count(sync.ActionCreate))
+	log.Printf("%d issues updated", plan.Count(sync.ActionUpdate))
+	log.Printf("%d issues closed", plan.Count(sync.ActionClose))
+	log.Printf("%d issues reopened", plan.Count(sync.ActionReopen))
+	log.Printf("%d duplicate issues closed", plan.Count(sync.ActionCloseDuplicate))
+	log.Printf("%d issues relabelled", plan.Count(sync.ActionRelabel))
+}
+
+// newGitHubClient returns a GitHub client, and whether a token was provided for it
+func newGitHubClient(ctx context.Context, hc *http.Client) (*github.Client, bool) {
 	// Also available in the environment as GITHUB_TOKEN
 	ghToken := *githubTokenFlag
 
@@ -47,190 +163,383 @@ func main() {
 		}
 		ghToken = strings.TrimSpace(string(bs))
 	}
-	if ghToken == "" {
-		log.Printf("github-token is empty: skipping github calls")
+	if ghToken == "" && *replayFlag != "" {
+		// Recorded traffic has its tokens scrubbed, so any value will do
+		ghToken = "replay"
 	}
 
-	ctx := context.Background()
-	tc := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: ghToken}))
-	gc := github.NewClient(tc)
+	tc := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, hc), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: ghToken}))
+	return github.NewClient(tc), ghToken != ""
+}
 
+// splitRepo returns the org and project of a GitHub repository name
+func splitRepo(repo string) (string, string, error) {
+	org, project, ok := strings.Cut(repo, "/")
+	if !ok {
+		return "", "", fmt.Errorf("invalid github repo %q: expected org/project", repo)
+	}
+	return org, project, nil
+}
+
+// managedLabels returns every label that synced issues may be given
+func managedLabels(reportKeys []string) []string {
+	labels := []string{issue.SyncLabel, issue.DisabledLabel, issue.PassingLabel, issue.ExcludedLabel, issue.DuplicateLabel, *githubLabelFlag}
+	for _, k := range reportKeys {
+		labels = append(labels, issue.FrameworkLabel(k))
+	}
+	if ws := workspaceName(); ws != "" {
+		labels = append(labels, issue.WorkspaceLabel(ws))
+	}
+	return labels
+}
+
+// discoveryDue returns true if discovery is enabled, and has not run within --full-refresh-interval when using --state-file,
+// as GitHub search has a much lower rate limit than the rest of the API
+func discoveryDue(src secureframe.TestSource) bool {
+	if *discoveryFlag == "none" {
+		return false
+	}
+	if sc, ok := src.(*secureframe.Client); ok && sc.State != nil && !sc.State.DiscoveryDue(*fullRefreshFlag) {
+		log.Printf("skipping discovery: last ran at %s", sc.State.LastDiscovery.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// discoverIssues returns the managed issues that are missing their sync label, logging a warning for each
+func discoverIssues(ctx context.Context, gc *github.Client, org string, project string, full bool, tests []secureframe.Test, issues []*github.Issue) ([]issue.Discovered, error) {
+	keys := map[string]string{}
+	for _, t := range tests {
+		keys[t.V2.Key] = t.ID
+	}
+	known := map[int]bool{}
+	for _, i := range issues {
+		known[i.GetNumber()] = true
+	}
+
+	found, err := issue.Discover(ctx, gc, org, project, full, keys, known)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range found {
+		log.Printf("WARNING: #%d (%s) is missing the %q label: found by its %s", d.Issue.GetNumber(), d.Issue.GetTitle(), issue.SyncLabel, d.How)
+	}
+	return found, nil
+}
+
+// planSync fetches Secureframe tests and GitHub issues, returning the plan that reconciles them and the source
+// the tests came from. The plan is nil if Secureframe returned no tests, as closing every issue is never intended.
+func planSync(ctx context.Context, hc *http.Client, gc *github.Client, hasToken bool) (*sync.Plan, secureframe.TestSource, error) {
 	// NOTE: sfTokenFlag is also available in the environment as SECUREFRAME_TOKEN
-	tests, err := secureframe.GetTests(context.Background(), *companyIDFlag, *sfTokenFlag, *reportKeyFlag)
+	excluded := secureframe.NewExclusions()
+	src, err := newSource(hc, excluded)
 	if err != nil {
-		log.Panicf("Secureframe test query failed: %v", err)
+		return nil, nil, fmt.Errorf("source: %w", err)
+	}
+
+	reportKeys := selectedReports()
+
+	tests, err := src.GetTests(ctx, reportKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("secureframe test query: %w", err)
 	}
 
 	log.Printf("%d Secureframe tests found", len(tests))
 	if len(tests) == 0 {
-		os.Exit(0)
+		return nil, src, nil
 	}
 
-	parts := strings.Split(*githubRepoFlag, "/")
-	org := parts[0]
-	project := parts[1]
+	org, project, err := splitRepo(*githubRepoFlag)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	issues := []*github.Issue{}
-	if ghToken != "" {
+	if hasToken {
 		issues, err = issue.Synced(ctx, gc, org, project)
 		if err != nil {
-			log.Panicf("synced: %v", err)
+			return nil, nil, fmt.Errorf("synced: %w", err)
 		}
 	}
 
-	log.Printf("syncing labels ...")
-	labels := []string{issue.SyncLabel, issue.DisabledLabel, issue.PassingLabel, *githubLabelFlag}
-	if !*dryRunFlag {
-		if err := issue.SyncLabels(ctx, gc, org, project, labels); err != nil {
-			log.Panicf("sync labels: %v", err)
+	// Test IDs of issues found by discovery, which may not be recognizable from their body
+	discoveredIDs := map[int]string{}
+	relabels := []sync.Action{}
+	discover := func(full bool) error {
+		found, err := discoverIssues(ctx, gc, org, project, full, tests, issues)
+		if err != nil {
+			return fmt.Errorf("discover: %w", err)
+		}
+		for _, d := range found {
+			discoveredIDs[d.Issue.GetNumber()] = d.TestID
+			relabels = append(relabels, sync.Relabel(d))
+			issues = append(issues, d.Issue)
 		}
+		return nil
 	}
 
-	// issue by test ID
-	issuesByID := map[string]*github.Issue{}
-	for _, i := range issues {
-		id := ""
-		match := idRE.FindStringSubmatch(i.GetBody())
-		if len(match) > 0 {
-			// log.Printf("found match: %v", match)
-			id = match[1]
-			issuesByID[id] = i
-		} else {
-			log.Printf("no test ID found in issue[%s]: %+v", id, i.GetTitle())
+	discovered := false
+	if hasToken && discoveryDue(src) {
+		if err := discover(*discoveryFlag == "full"); err != nil {
+			return nil, nil, err
+		}
+		discovered = true
+		if sc, ok := src.(*secureframe.Client); ok && sc.State != nil {
+			sc.State.LastDiscovery = time.Now()
 		}
-		log.Printf("issue[%s]: %+v", id, i.GetTitle())
 	}
 
 	log.Printf("%d synced issues found", len(issues))
 
-	testsByID := map[string]secureframe.Test{}
-	lastWasMod := false
-	updates := 0
-
-	created := 0
-	reopened := 0
-	closed := 0
-	updated := 0
+	planner := &sync.Planner{
+		AdditionalLabel: *githubLabelFlag,
+		ReportKeys:      reportKeys,
+		Workspace:       workspaceName(),
+		PreferActive:    *canonicalFlag == "most-active",
+		Excluded:        excluded,
+		CloseExcluded:   *closeExcludedFlag,
+	}
+	log.Printf("planning %d tests ...", len(tests))
+	plan, err := planner.Plan(tests, sync.ByTestID(issues, discoveredIDs))
+	if err != nil {
+		return nil, nil, fmt.Errorf("plan: %w", err)
+	}
 
-	log.Printf("syncing %d tests ...", len(tests))
-	for _, t := range tests {
-		// Avoid Github API DoS attack
-		if lastWasMod && !*dryRunFlag {
-			log.Printf("Sleeping ...")
-			sleepTime := time.Duration(updates*sleepMS) * time.Millisecond
-			if sleepTime > maxSleepTime {
-				sleepTime = maxSleepTime
+	// An issue may have lost its label since discovery last ran, so search for one before creating any, whatever the cadence
+	if hasToken && !discovered && *discoveryFlag != "none" && plan.Count(sync.ActionCreate) > 0 {
+		log.Printf("searching for unlabelled issues before creating %d issues ...", plan.Count(sync.ActionCreate))
+		before := len(issues)
+		if err := discover(false); err != nil {
+			return nil, nil, err
+		}
+		if len(issues) > before {
+			plan, err = planner.Plan(tests, sync.ByTestID(issues, discoveredIDs))
+			if err != nil {
+				return nil, nil, fmt.Errorf("plan: %w", err)
 			}
-
-			time.Sleep(sleepTime)
-			updates++
-			lastWasMod = false
 		}
+	}
 
-		testsByID[t.ID] = t
-		// log.Printf("Creating issue template from test: %+v", t)
-		ft, err := issue.FromTest(t, *githubLabelFlag, *reportKeyFlag)
-		if err != nil {
-			log.Panicf("issue: %v", err)
+	// Labels are restored first, so that the issues are found by the next sync even if this one fails
+	plan.Actions = append(relabels, plan.Actions...)
+	plan.Repo = *githubRepoFlag
+	plan.Labels = managedLabels(reportKeys)
+	plan.Record(issues)
+	return plan, src, nil
+}
+
+// applyPlan creates the labels a plan relies on, then applies it to GitHub. In dry-run mode, actions are only logged.
+func applyPlan(ctx context.Context, gc *github.Client, plan *sync.Plan) error {
+	org, project, err := splitRepo(plan.Repo)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRunFlag {
+		log.Printf("syncing labels ...")
+		if err := issue.SyncLabels(ctx, gc, org, project, plan.Labels); err != nil {
+			return fmt.Errorf("sync labels: %w", err)
 		}
+	}
 
-		i := issuesByID[t.ID]
+	ex := sync.NewExecutor(&sync.GitHub{Client: gc, Org: org, Project: project, ManagedLabels: plan.Labels})
+	ex.DryRun = *dryRunFlag
+	return ex.Apply(ctx, plan)
+}
 
-		// Test does not exist in Github
-		if i == nil {
-			if t.Pass || !t.Enabled {
-				// log.Printf("Skipping passing test: %s", t.Description)
-				continue
-			}
+// Exit codes for Secureframe failures, so that schedulers can decide whether to retry or alert
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitSchemaChange = 65 // EX_DATAERR: the undocumented API changed and the tool needs updating
+	exitRateLimited  = 75 // EX_TEMPFAIL: try again later
+	exitUnauthorized = 77 // EX_NOPERM: the Secureframe token needs replacing
+)
 
-			log.Printf("Creating: %s", ft.Title)
-			created++
-			if !*dryRunFlag {
-				if err := issue.Create(ctx, gc, org, project, ft); err != nil {
-					log.Panicf("create: %v", err)
-				}
-				lastWasMod = true
-			}
-			continue
-		}
-
-		if i.GetState() == "open" {
-			// Close passing or disabled tests
-			if t.Pass {
-				log.Printf("Closing #%d (%s) as it is passing...", i.GetNumber(), i.GetTitle())
-				closed++
-				if !*dryRunFlag {
-					if err := issue.Close(ctx, gc, org, project, i, issue.PassingLabel); err != nil {
-						log.Panicf("close: %v", err)
-					}
-					lastWasMod = true
-				}
-				continue
-			}
+// exitCode classifies a Secureframe error into an exit code
+func exitCode(err error) int {
+	var gqlErr *secureframe.GraphQLError
+	if errors.As(err, &gqlErr) {
+		log.Printf("GraphQL error at path %v: %s (extensions: %v)", gqlErr.Path, gqlErr.Message, gqlErr.Extensions)
+	}
 
-			if !t.Enabled {
-				log.Printf("Closing #%d (%s) as it is disabled...", i.GetNumber(), i.GetTitle())
-				closed++
-				if !*dryRunFlag {
-					if err := issue.Close(ctx, gc, org, project, i, issue.DisabledLabel); err != nil {
-						log.Panicf("close: %v", err)
-					}
-					lastWasMod = true
-				}
-				continue
-			}
+	switch {
+	case errors.Is(err, secureframe.ErrUnauthorized):
+		log.Printf("Secureframe token is invalid or expired: please replace it")
+		return exitUnauthorized
+	case errors.Is(err, secureframe.ErrSchemaChanged):
+		log.Printf("Secureframe API schema appears to have changed: secureframe-issue-sync needs updating")
+		return exitSchemaChange
+	case errors.Is(err, secureframe.ErrRateLimited), errors.Is(err, secureframe.ErrUnavailable):
+		log.Printf("Secureframe is temporarily unavailable: try again later")
+		return exitRateLimited
+	default:
+		return exitFailure
+	}
+}
 
-			// Update failing tests
-			if i.GetBody() != ft.Body || i.GetTitle() != ft.Title {
-				updated++
-				log.Printf("Updating #%d: %s", i.GetNumber(), ft.Title)
-				if !*dryRunFlag {
-					if err := issue.Update(ctx, gc, org, project, i.GetNumber(), ft); err != nil {
-						log.Panicf("update: %v", err)
-					}
-					lastWasMod = true
-				}
-			}
-			continue
-		}
-
-		if i.GetState() == "closed" {
-			if !t.Pass && t.Enabled {
-				reopened++
-				log.Printf("Reopening #%d (%s) ...", i.GetNumber(), i.GetTitle())
-				if !*dryRunFlag {
-					if err := issue.Update(ctx, gc, org, project, i.GetNumber(), ft); err != nil {
-						log.Panicf("update: %v", err)
-					}
-					lastWasMod = true
-				}
-				continue
-			}
+// newHTTPClient returns the HTTP client shared by Secureframe and GitHub, which may record or replay traffic
+func newHTTPClient() (*http.Client, error) {
+	switch {
+	case *recordFlag != "" && *replayFlag != "":
+		return nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	case *recordFlag != "":
+		r, err := cassette.NewRecorder(*recordFlag, http.DefaultTransport)
+		if err != nil {
+			return nil, err
 		}
+		log.Printf("recording HTTP traffic to %s", *recordFlag)
+		return &http.Client{Transport: r}, nil
+	case *replayFlag != "":
+		r, err := cassette.NewReplayer(*replayFlag)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("replaying HTTP traffic from %s", *replayFlag)
+		return &http.Client{Transport: r}, nil
+	default:
+		return http.DefaultClient, nil
+	}
+}
+
+// newGraphQLClient returns a client for the undocumented Secureframe GraphQL API
+func newGraphQLClient(hc *http.Client) *secureframe.Client {
+	sc := secureframe.NewClient(*companyIDFlag, *sfTokenFlag)
+	sc.Endpoint = *sfEndpointFlag
+	sc.HTTPClient = hc
+	sc.Retry.MaxAttempts = *sfMaxAttemptsFlag
+	sc.Limiter = secureframe.NewLimiter(*sfRateFlag, 1)
+	sc.Concurrency = *sfConcurrencyFlag
+	sc.BatchSize = *sfBatchSizeFlag
+	sc.WorkspaceID = *workspaceIDFlag
+	sc.CompanyFrameworkID = *companyFwIDFlag
+	return sc
+}
+
+// newSource returns the Secureframe backend selected by --source. Tests skipped by filters are recorded in excluded, if set.
+func newSource(hc *http.Client, excluded *secureframe.Exclusions) (secureframe.TestSource, error) {
+	limiter := secureframe.NewLimiter(*sfRateFlag, 1)
+	if *replayFlag != "" {
+		limiter = nil
 	}
 
-	// Close Github issues that are no longer being tracked by Secureframe
-	for id, i := range issuesByID {
-		_, ok := testsByID[id]
-		if ok {
-			continue
+	filter, err := newFilter()
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+
+	switch *sourceFlag {
+	case "graphql":
+		sc := newGraphQLClient(hc)
+		sc.Limiter = limiter
+		sc.Filter = filter
+		sc.Excluded = excluded
+		if *stateFileFlag != "" {
+			s, err := secureframe.LoadState(*stateFileFlag)
+			if err != nil {
+				return nil, fmt.Errorf("load state: %w", err)
+			}
+			sc.State = s
+			sc.FullRefreshInterval = *fullRefreshFlag
+		}
+		// Cache hits would be missing from recordings, and replays have no need for them
+		if *cacheDirFlag != "" && *recordFlag == "" && *replayFlag == "" {
+			sc.Cache = secureframe.NewCache(*cacheDirFlag, *cacheTTLFlag)
+		}
+		if *noCacheFlag {
+			sc.Cache = nil
 		}
-		if i.GetState() == "closed" {
-			continue
+		return sc, nil
+	case "rest":
+		if *workspaceIDFlag != "" || *companyFwIDFlag != "" {
+			return nil, fmt.Errorf("--workspace-id and --company-framework-id are not supported by the REST source")
 		}
-		log.Printf("Closing #%d (%s) as it is no longer tracked by Secureframe...", i.GetNumber(), i.GetTitle())
-		closed++
-		if !*dryRunFlag {
-			if err := issue.Close(ctx, gc, org, project, i, issue.DisabledLabel); err != nil {
-				log.Panicf("close: %v", err)
+		rc := secureframe.NewRESTClient(*sfTokenFlag)
+		rc.Endpoint = *sfRESTEndpointFlag
+		rc.HTTPClient = hc
+		rc.Retry.MaxAttempts = *sfMaxAttemptsFlag
+		rc.Limiter = limiter
+		rc.Concurrency = *sfConcurrencyFlag
+		rc.Filter = filter
+		rc.Excluded = excluded
+		return rc, nil
+	default:
+		if strings.HasPrefix(*sourceFlag, "file:") {
+			fs, err := snapshot.NewFileSource(strings.TrimPrefix(*sourceFlag, "file:"))
+			if err != nil {
+				return nil, fmt.Errorf("file source: %w", err)
 			}
-			time.Sleep(250 * time.Millisecond)
+			fs.Filter = filter
+			fs.Excluded = excluded
+			return fs, nil
 		}
-		continue
+		return nil, fmt.Errorf("unknown source: %q", *sourceFlag)
+	}
+}
+
+// newFilter returns the test filter described by the --include-* and --exclude-* flags
+func newFilter() (*secureframe.Filter, error) {
+	include := secureframe.Criteria{
+		Domains:            splitList(*includeDomainsFlag),
+		Functions:          splitList(*includeFuncsFlag),
+		Types:              splitList(*includeTypesFlag),
+		ResourceCategories: splitList(*includeCatsFlag),
+		Tags:               splitList(*includeTagsFlag),
+		Owners:             splitList(*includeOwnersFlag),
+		Keys:               splitList(*includeKeysFlag),
 	}
+	exclude := secureframe.Criteria{
+		Domains:            splitList(*excludeDomainsFlag),
+		Functions:          splitList(*excludeFuncsFlag),
+		Types:              splitList(*excludeTypesFlag),
+		ResourceCategories: splitList(*excludeCatsFlag),
+		Tags:               splitList(*excludeTagsFlag),
+		Owners:             splitList(*excludeOwnersFlag),
+		Keys:               splitList(*excludeKeysFlag),
+	}
+	return secureframe.NewFilter(include, exclude)
+}
+
+// runCache implements the cache command, returning the exit code
+func runCache(args []string) int {
+	if len(args) != 1 || args[0] != "clear" {
+		log.Printf("usage: cache clear (flags must precede clear)")
+		return exitUsage
+	}
+	if *cacheDirFlag == "" {
+		log.Printf("no cache directory: set --cache-dir")
+		return exitUsage
+	}
+	if err := secureframe.NewCache(*cacheDirFlag, *cacheTTLFlag).Clear(); err != nil {
+		log.Printf("clear cache: %v", err)
+		return exitFailure
+	}
+	return 0
+}
 
-	log.Printf("%d issues created", created)
-	log.Printf("%d issues updated", updated)
-	log.Printf("%d issues closed", closed)
-	log.Printf("%d issues reopened", reopened)
+// selectedReports returns the report keys given by --reports, falling back to --report-key
+func selectedReports() []string {
+	if keys := splitList(*reportsFlag); len(keys) > 0 {
+		return keys
+	}
+	return splitList(*reportKeyFlag)
+}
+
+// workspaceName returns the workspace name used for issue labels and metadata, if any
+func workspaceName() string {
+	if *workspaceNameFlag != "" {
+		return *workspaceNameFlag
+	}
+	return *workspaceIDFlag
+}
+
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
 }
@@ -0,0 +1,239 @@
+// Package cassette records HTTP traffic to disk, and replays it back, so that syncs can be reproduced offline.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// scrubbed is the value that sensitive data is replaced with
+const scrubbed = "REDACTED"
+
+var (
+	// sensitiveHeaders are never written to disk
+	sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key"}
+	// sensitiveParams are query parameters that are never written to disk
+	sensitiveParams = []string{"access_token", "token", "api_key", "secret"}
+)
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is a single recorded request and response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// key identifies equivalent requests, so that they can be matched up on replay
+func (r Request) key() string {
+	h := sha256.Sum256([]byte(r.Body))
+	return fmt.Sprintf("%s %s %s", r.Method, r.URL, hex.EncodeToString(h[:]))
+}
+
+func scrubHeader(h http.Header) http.Header {
+	c := h.Clone()
+	for _, k := range sensitiveHeaders {
+		if c.Get(k) != "" {
+			c.Set(k, scrubbed)
+		}
+	}
+	return c
+}
+
+func scrubURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	q := c.Query()
+	for _, k := range sensitiveParams {
+		if q.Has(k) {
+			q.Set(k, scrubbed)
+		}
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+// readBody reads and replaces a request body, so that it may still be sent
+func readBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	bs, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(bs))
+	return string(bs), nil
+}
+
+// Recorder is an http.RoundTripper that writes every interaction to a directory
+type Recorder struct {
+	// Dir is the directory interactions are written to
+	Dir string
+	// Transport makes the actual requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewRecorder returns a recorder that writes to dir, creating it if necessary
+func NewRecorder(dir string, t http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir: %w", err)
+	}
+	return &Recorder{Dir: dir, Transport: t}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+
+	t := r.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	rb, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(rb))
+
+	i := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    scrubURL(req.URL),
+			Header: scrubHeader(req.Header),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     scrubHeader(resp.Header),
+			Body:       string(rb),
+		},
+	}
+
+	if err := r.write(i); err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) write(i Interaction) error {
+	bs, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.n++
+	path := filepath.Join(r.Dir, fmt.Sprintf("%05d.json", r.n))
+	r.mu.Unlock()
+
+	log.Printf("recording %s %s to %s", i.Request.Method, i.Request.URL, path)
+	return os.WriteFile(path, bs, 0o600)
+}
+
+// Replayer is an http.RoundTripper that serves responses from a directory written by Recorder
+type Replayer struct {
+	mu sync.Mutex
+	// queued responses by request key, in the order they were recorded
+	queued map[string][]Response
+}
+
+// NewReplayer loads every interaction within dir
+func NewReplayer(dir string) (*Replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+	sort.Strings(paths)
+
+	r := &Replayer{queued: map[string][]Response{}}
+	for _, p := range paths {
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+		i := Interaction{}
+		if err := json.Unmarshal(bs, &i); err != nil {
+			return nil, fmt.Errorf("unmarshal %s: %w", p, err)
+		}
+		k := i.Request.key()
+		r.queued[k] = append(r.queued[k], i.Response)
+	}
+
+	log.Printf("loaded %d interactions from %s", len(paths), dir)
+	return r, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+
+	rr := Request{Method: req.Method, URL: scrubURL(req.URL), Body: body}
+	k := rr.key()
+
+	r.mu.Lock()
+	q := r.queued[k]
+	if len(q) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response for %s %s", rr.Method, rr.URL)
+	}
+	resp := q[0]
+	// The final response is served for any further identical requests
+	if len(q) > 1 {
+		r.queued[k] = q[1:]
+	}
+	r.mu.Unlock()
+
+	log.Printf("replaying %s %s: %d", rr.Method, rr.URL, resp.StatusCode)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        resp.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package issue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v44/github"
+)
+
+// Discovered is a managed issue that has lost SyncLabel, so was not returned by Synced
+type Discovered struct {
+	Issue  *github.Issue
+	TestID string
+	// How describes how the issue was recognized, for logging
+	How string
+}
+
+// identify returns the test ID of an issue that appears to be managed, using its body or, failing that, the test key in its title.
+// keys maps test keys to test IDs.
+func identify(i *github.Issue, keys map[string]string) (string, string, bool) {
+	if id, ok := TestID(i.GetBody()); ok {
+		return id, "body", true
+	}
+	key, _, ok := strings.Cut(i.GetTitle(), ": ")
+	if !ok {
+		return "", "", false
+	}
+	if id, ok := keys[key]; ok {
+		return id, "title", true
+	}
+	return "", "", false
+}
+
+// Discover finds managed issues that are missing SyncLabel. By default, GitHub search is used to find issues whose
+// body mentions secureframe-issue-sync. If full is set, every issue within the project is listed instead, which is
+// slower but also finds issues by the test key in their title. keys maps test keys to test IDs, and known lists the
+// numbers of issues that have already been found, which are skipped.
+func Discover(ctx context.Context, gc *github.Client, org string, project string, full bool, keys map[string]string, known map[int]bool) ([]Discovered, error) {
+	var candidates []*github.Issue
+	var err error
+	if full {
+		candidates, err = listAll(ctx, gc, org, project)
+	} else {
+		candidates, err = search(ctx, gc, org, project)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := []Discovered{}
+	for _, i := range candidates {
+		if known[i.GetNumber()] || i.IsPullRequest() || hasLabel(i, SyncLabel) {
+			continue
+		}
+		id, how, ok := identify(i, keys)
+		if !ok {
+			continue
+		}
+		found = append(found, Discovered{Issue: i, TestID: id, How: how})
+	}
+	return found, nil
+}
+
+// search returns issues without SyncLabel whose body mentions secureframe-issue-sync, as every rendered issue does
+func search(ctx context.Context, gc *github.Client, org string, project string) ([]*github.Issue, error) {
+	q := fmt.Sprintf(`repo:%s/%s is:issue -label:%q in:body "secureframe-issue-sync"`, org, project, SyncLabel)
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	log.Printf("searching for unlabelled issues: %s", q)
+	result := []*github.Issue{}
+	for page := 1; page != 0; {
+		opts.ListOptions.Page = page
+		r, resp, err := gc.Search.Issues(ctx, q, opts)
+		if err != nil {
+			return result, fmt.Errorf("search: %w", err)
+		}
+		result = append(result, r.Issues...)
+		page = resp.NextPage
+	}
+	return result, nil
+}
+
+// listAll returns every issue within a project, regardless of labels
+func listAll(ctx context.Context, gc *github.Client, org string, project string) ([]*github.Issue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	log.Printf("listing every issue in %s/%s ...", org, project)
+	result := []*github.Issue{}
+	for page := 1; page != 0; {
+		opts.ListOptions.Page = page
+		issues, resp, err := gc.Issues.ListByRepo(ctx, org, project, opts)
+		if err != nil {
+			return result, fmt.Errorf("list: %w", err)
+		}
+		result = append(result, issues...)
+		page = resp.NextPage
+	}
+	return result, nil
+}
+
+// Relabel restores SyncLabel to a discovered issue
+func Relabel(ctx context.Context, gc *github.Client, org string, project string, i *github.Issue) error {
+	if err := setLabels(ctx, gc, org, project, i.GetNumber(), []string{SyncLabel}, nil); err != nil {
+		return err
+	}
+	name := SyncLabel
+	i.Labels = append(i.Labels, &github.Label{Name: &name})
+	return nil
+}
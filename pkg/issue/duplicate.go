@@ -0,0 +1,94 @@
+package issue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/google/go-github/v44/github"
+)
+
+// DuplicateLabel is added to issues that were closed as a duplicate of another issue for the same test.
+// It is namespaced so that issues humans close with GitHub's stock "duplicate" label are still synced.
+var DuplicateLabel = "secureframe-duplicate"
+
+// IsClosedDuplicate returns true if an issue was closed as a duplicate, so should no longer be synced
+func IsClosedDuplicate(i *github.Issue) bool {
+	return i.GetState() == closed && hasLabel(i, DuplicateLabel)
+}
+
+// Canonical chooses which of several issues for the same test should be kept, returning it and the rest.
+// Open issues are preferred. Among those, the oldest is chosen, or if byActivity is set, the one with the most comments.
+func Canonical(issues []*github.Issue, byActivity bool) (*github.Issue, []*github.Issue) {
+	sorted := append([]*github.Issue{}, issues...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		ia, ib := sorted[a], sorted[b]
+		if (ia.GetState() == open) != (ib.GetState() == open) {
+			return ia.GetState() == open
+		}
+		if byActivity && ia.GetComments() != ib.GetComments() {
+			return ia.GetComments() > ib.GetComments()
+		}
+		if !ia.GetCreatedAt().Equal(ib.GetCreatedAt()) {
+			return ia.GetCreatedAt().Before(ib.GetCreatedAt())
+		}
+		return ia.GetNumber() < ib.GetNumber()
+	})
+	return sorted[0], sorted[1:]
+}
+
+// CloseDuplicate closes dup with a comment linking to canonical, after copying any labels that are not
+// managed by syncs, and any assignees, over to canonical.
+func CloseDuplicate(ctx context.Context, gc *github.Client, org string, project string, canonical *github.Issue, dup *github.Issue, managed []string) error {
+	log.Printf("closing #%d as a duplicate of #%d", dup.GetNumber(), canonical.GetNumber())
+
+	isManaged := map[string]bool{DuplicateLabel: true}
+	for _, l := range managed {
+		isManaged[l] = true
+	}
+
+	labels := []string{}
+	for _, l := range dup.Labels {
+		if n := l.GetName(); !isManaged[n] && !hasLabel(canonical, n) {
+			labels = append(labels, n)
+		}
+	}
+	if err := setLabels(ctx, gc, org, project, canonical.GetNumber(), labels, nil); err != nil {
+		return err
+	}
+	for _, l := range labels {
+		name := l
+		canonical.Labels = append(canonical.Labels, &github.Label{Name: &name})
+	}
+
+	assigned := map[string]bool{}
+	for _, u := range canonical.Assignees {
+		assigned[u.GetLogin()] = true
+	}
+	assignees := []string{}
+	for _, u := range dup.Assignees {
+		if !assigned[u.GetLogin()] {
+			assignees = append(assignees, u.GetLogin())
+		}
+	}
+	if len(assignees) > 0 {
+		log.Printf("assigning #%d to %s", canonical.GetNumber(), assignees)
+		updated, _, err := gc.Issues.AddAssignees(ctx, org, project, canonical.GetNumber(), assignees)
+		if err != nil {
+			return fmt.Errorf("add assignees: %w", err)
+		}
+		canonical.Assignees = updated.Assignees
+	}
+
+	body := fmt.Sprintf("Duplicate of #%d\n\nsecureframe-issue-sync found more than one issue for this Secureframe test, and is keeping #%d.", canonical.GetNumber(), canonical.GetNumber())
+	if _, _, err := gc.Issues.CreateComment(ctx, org, project, dup.GetNumber(), &github.IssueComment{Body: &body}); err != nil {
+		return fmt.Errorf("comment: %w", err)
+	}
+
+	ir := &github.IssueRequest{State: &closed}
+	if _, _, err := gc.Issues.Edit(ctx, org, project, dup.GetNumber(), ir); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return setLabels(ctx, gc, org, project, dup.GetNumber(), []string{DuplicateLabel}, nil)
+}
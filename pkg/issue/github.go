@@ -13,6 +13,8 @@ var (
 	SyncLabel     = "secureframe"
 	DisabledLabel = "disabled"
 	PassingLabel  = "passing"
+	// ExcludedLabel is added to issues closed because their test is excluded by filters
+	ExcludedLabel = "secureframe-excluded"
 
 	open   = "open"
 	closed = "closed"
@@ -98,36 +100,128 @@ func Create(ctx context.Context, gc *github.Client, org string, project string,
 	return err
 }
 
-// Update creates an issue
-func Update(ctx context.Context, gc *github.Client, org string, project string, id int, ft IssueForm) error {
+// NeedsUpdate returns true if an issue differs from how it would be rendered now. Only the visible content
+// of the managed section is considered, so that neither human notes nor a new sync version alone update an
+// issue, but issues without a current metadata marker or managed section are updated in order to migrate them.
+// Managed sections that were edited by hand are rewritten.
+func NeedsUpdate(i *github.Issue, ft IssueForm) bool {
+	if i.GetTitle() != ft.Title {
+		return true
+	}
+	if add, remove := labelChanges(i, ft); len(add) > 0 || len(remove) > 0 {
+		return true
+	}
+	m, ok := ParseMetadata(i.GetBody())
+	if !ok || m.Version != MetadataVersion {
+		return true
+	}
+	if _, _, ok := managedRange(i.GetBody()); !ok {
+		return true
+	}
+	if HandEdited(i.GetBody()) {
+		return true
+	}
+	// An unedited section is as it was rendered, so its hash is enough to tell whether the content has changed
+	if m.Hash != "" {
+		return m.Hash != ft.Metadata.Hash
+	}
+	return managedContent(i.GetBody()) != managedContent(ft.Body)
+}
+
+// labelChanges returns the managed labels to add to and remove from an issue, leaving any others alone
+func labelChanges(i *github.Issue, ft IssueForm) ([]string, []string) {
+	current := map[string]bool{}
+	for _, l := range i.Labels {
+		current[l.GetName()] = true
+	}
+	wanted := map[string]bool{}
+	for _, l := range ft.Labels {
+		wanted[l] = true
+	}
+
+	add := []string{}
+	for _, l := range ft.Labels {
+		if !current[l] {
+			add = append(add, l)
+		}
+	}
+
+	remove := []string{}
+	seen := map[string]bool{}
+	for _, l := range ft.ManagedLabels {
+		if current[l] && !wanted[l] && !seen[l] {
+			remove = append(remove, l)
+		}
+		seen[l] = true
+	}
+	return add, remove
+}
+
+// setLabels adds and removes labels from an issue
+func setLabels(ctx context.Context, gc *github.Client, org string, project string, number int, add []string, remove []string) error {
+	if len(add) > 0 {
+		log.Printf("adding labels to #%d: %s", number, add)
+		if _, _, err := gc.Issues.AddLabelsToIssue(ctx, org, project, number, add); err != nil {
+			return fmt.Errorf("add labels: %w", err)
+		}
+	}
+	for _, l := range remove {
+		log.Printf("removing label from #%d: %s", number, l)
+		if _, err := gc.Issues.RemoveLabelForIssue(ctx, org, project, number, l); err != nil {
+			return fmt.Errorf("remove label %q: %w", l, err)
+		}
+	}
+	return nil
+}
+
+// Update updates an issue, replacing only the managed section of its body and managed labels.
+// Other labels, assignees and milestones are left untouched.
+func Update(ctx context.Context, gc *github.Client, org string, project string, i *github.Issue, ft IssueForm) error {
 	log.Printf("updating github issue: %s", ft.Title)
-	i := &github.IssueRequest{
-		Title:  &ft.Title,
-		Body:   &ft.Body,
-		Labels: &ft.Labels,
-		State:  &open,
+	body := MergeBody(i.GetBody(), ft.Body)
+	ir := &github.IssueRequest{
+		Title: &ft.Title,
+		Body:  &body,
+		State: &open,
 	}
-	_, _, err := gc.Issues.Edit(ctx, org, project, id, i)
-	return err
+	if _, _, err := gc.Issues.Edit(ctx, org, project, i.GetNumber(), ir); err != nil {
+		return err
+	}
+
+	add, remove := labelChanges(i, ft)
+	return setLabels(ctx, gc, org, project, i.GetNumber(), add, remove)
 }
 
-// Close closes an issue
+// Close closes an issue, labelling it with why. Its title, body and any other labels are left untouched.
 func Close(ctx context.Context, gc *github.Client, org string, project string, i *github.Issue, label string) error {
-	title := i.GetTitle()
-	log.Printf("closing github issue: %s", title)
-	body := i.GetBody()
-	labels := []string{}
+	log.Printf("closing github issue: %s", i.GetTitle())
+	ir := &github.IssueRequest{
+		State: &closed,
+	}
+	if _, _, err := gc.Issues.Edit(ctx, org, project, i.GetNumber(), ir); err != nil {
+		return err
+	}
+
+	// An issue is closed for a single reason, so only has one of these labels
+	add := []string{}
+	remove := []string{}
 	for _, l := range i.Labels {
-		labels = append(labels, l.GetName())
+		if n := l.GetName(); (n == PassingLabel || n == DisabledLabel || n == ExcludedLabel) && n != label {
+			remove = append(remove, n)
+		}
+	}
+	if !hasLabel(i, label) {
+		add = append(add, label)
 	}
-	labels = append(labels, label)
+	return setLabels(ctx, gc, org, project, i.GetNumber(), add, remove)
+}
 
-	ir := &github.IssueRequest{
-		Title:  &title,
-		Body:   &body,
-		State:  &closed,
-		Labels: &labels,
+// hasLabel returns true if an issue has a label
+func hasLabel(i *github.Issue, label string) bool {
+	for _, l := range i.Labels {
+		if l.GetName() == label {
+			return true
+		}
 	}
-	_, _, err := gc.Issues.Edit(ctx, org, project, i.GetNumber(), ir)
-	return err
+	return false
 }
@@ -0,0 +1,72 @@
+package issue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v44/github"
+)
+
+func TestNeedsUpdate(t *testing.T) {
+	ft := rendered(t, "a", "requirement")
+	changed := rendered(t, "a", "changed requirement")
+
+	tests := []struct {
+		name  string
+		title string
+		body  string
+		want  bool
+	}{
+		{name: "up to date", body: ft.Body},
+		{name: "text before and after", body: "notes\n\n" + ft.Body + "\n\n- [ ] checklist"},
+		{name: "windows line endings", body: strings.ReplaceAll(ft.Body, "\n", "\r\n")},
+		{name: "newer sync version", body: strings.Replace(ft.Body, ft.Metadata.SyncVersion, "v0.0.1", 1)},
+		{name: "content changed", body: changed.Body, want: true},
+		{name: "title changed", title: "old title", body: ft.Body, want: true},
+		{name: "edited by hand", body: strings.Replace(ft.Body, "requirement", "hand-written requirement", 1), want: true},
+		{name: "legacy body without markers", body: managedContent(ft.Body), want: true},
+		{name: "missing end marker", body: strings.Replace(ft.Body, managedEnd, "", 1), want: true},
+		{name: "missing marker", body: stripMarker(ft.Body), want: true},
+		{name: "older marker version", body: bumped(ft.Body), want: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			title := ft.Title
+			if tc.title != "" {
+				title = tc.title
+			}
+			i := &github.Issue{Title: github.String(title), Body: github.String(tc.body)}
+			for _, l := range ft.Labels {
+				i.Labels = append(i.Labels, &github.Label{Name: github.String(l)})
+			}
+
+			if got := NeedsUpdate(i, ft); got != tc.want {
+				t.Errorf("NeedsUpdate = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandEdited(t *testing.T) {
+	body := rendered(t, "a", "requirement").Body
+
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "as rendered", body: body},
+		{name: "text before and after", body: "notes\n\n" + body + "\n\nmore notes"},
+		{name: "edited inside the managed block", body: strings.Replace(body, "requirement", "edited", 1), want: true},
+		{name: "legacy body without markers", body: managedContent(body)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := HandEdited(tc.body); got != tc.want {
+				t.Errorf("HandEdited = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html"
 	"log"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -23,6 +24,10 @@ type IssueForm struct {
 	Title  string
 	Body   string
 	Labels []string
+	// ManagedLabels are the labels that syncs may add or remove. Any other labels belong to humans.
+	ManagedLabels []string
+	// Metadata is also embedded within Body as a hidden marker
+	Metadata Metadata
 }
 
 func assertWork(a secureframe.AssertionResult) string {
@@ -69,33 +74,92 @@ func makeMarkdown(html string) string {
 	return markdown
 }
 
-func FromTest(t secureframe.Test, additionalLabel string, reportKey string) (IssueForm, error) {
-	reportLabel, _, _ := strings.Cut(reportKey, "_")
-	labels := []string{SyncLabel, reportLabel}
-	if additionalLabel != "" {
+// FrameworkLabel returns the GitHub label used for a framework report key, such as "soc2" for "soc2_alpha"
+func FrameworkLabel(reportKey string) string {
+	label, _, _ := strings.Cut(reportKey, "_")
+	return label
+}
+
+// WorkspaceLabel returns the GitHub label used for a Secureframe workspace
+func WorkspaceLabel(workspace string) string {
+	return "workspace:" + workspace
+}
+
+// formatDate formats a timestamp as a date. Relative times are avoided, as they would change the
+// issue body on every sync.
+func formatDate(t secureframe.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// formatNumber formats an integer with thousands separators, such as 4,812
+func formatNumber(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatNumber(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// FromTest renders the issue for a test. workspace is the name of the Secureframe workspace being synced, if any.
+func FromTest(t secureframe.Test, additionalLabel string, reportKeys []string, workspace string) (IssueForm, error) {
+	frameworks := t.Frameworks(reportKeys)
+	labels := []string{SyncLabel}
+	seen := map[string]bool{SyncLabel: true}
+	for _, f := range frameworks {
+		l := FrameworkLabel(f.Key)
+		if l == "" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		labels = append(labels, l)
+	}
+	if workspace != "" {
+		labels = append(labels, WorkspaceLabel(workspace))
+		seen[WorkspaceLabel(workspace)] = true
+	}
+	if additionalLabel != "" && !seen[additionalLabel] {
 		labels = append(labels, additionalLabel)
 	}
 
+	// Framework labels for every report being synced are managed, so that they are removed from tests that no longer apply
+	managed := append([]string{DisabledLabel, PassingLabel, ExcludedLabel}, labels...)
+	for _, k := range reportKeys {
+		managed = append(managed, FrameworkLabel(k))
+	}
+
 	i := IssueForm{
-		Title:  fmt.Sprintf("%s: %s", t.V2.Key, t.V2.Title),
-		Labels: labels,
+		Title:         fmt.Sprintf("%s: %s", t.V2.Key, t.V2.Title),
+		Labels:        labels,
+		ManagedLabels: managed,
 	}
 
 	tmpl, err := template.New("issue").Funcs(template.FuncMap{
 		"Unescape":   html.UnescapeString,
 		"AssertWork": assertWork,
 		"Markdown":   makeMarkdown,
+		"Date":       formatDate,
+		"Number":     formatNumber,
 	}).Parse(issueTmpl)
 	if err != nil {
 		return i, fmt.Errorf("parse: %v", err)
 	}
 
 	data := struct {
-		Test      secureframe.Test
-		ReportKey string
+		Test       secureframe.Test
+		ReportKeys []string
+		Frameworks []secureframe.Framework
+		Workspace  string
 	}{
-		Test:      t,
-		ReportKey: reportKey,
+		Test:       t,
+		ReportKeys: reportKeys,
+		Frameworks: frameworks,
+		Workspace:  workspace,
 	}
 
 	var tpl bytes.Buffer
@@ -109,5 +173,21 @@ func FromTest(t secureframe.Test, additionalLabel string, reportKey string) (Iss
 		i.Body = i.Body[0:maxIssueBody] + "…"
 	}
 
+	// Markers are added after truncation, so that they are never cut off
+	i.Body = strings.TrimRight(i.Body, "\n")
+	i.Metadata = Metadata{
+		Version:     MetadataVersion,
+		TestID:      t.ID,
+		Key:         t.V2.Key,
+		Frameworks:  []string{},
+		Workspace:   workspace,
+		Hash:        contentHash(managedContent(i.Body)),
+		SyncVersion: syncVersion(),
+	}
+	for _, f := range frameworks {
+		i.Metadata.Frameworks = append(i.Metadata.Frameworks, f.Key)
+	}
+	i.Body = managedBegin + "\n" + i.Body + "\n\n" + i.Metadata.Marker() + "\n" + managedEnd
+
 	return i, nil
 }
@@ -0,0 +1,151 @@
+package issue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// MetadataVersion is bumped whenever the format of the hidden metadata marker changes
+const MetadataVersion = 1
+
+const (
+	markerPrefix = "<!-- secureframe-issue-sync: "
+	markerSuffix = " -->"
+
+	// managedBegin and managedEnd surround the part of an issue body that is rewritten by syncs.
+	// Anything outside of them is left alone, so that humans may add their own notes.
+	managedBegin = "<!-- secureframe-issue-sync:begin -->"
+	managedEnd   = "<!-- secureframe-issue-sync:end -->"
+)
+
+var (
+	// markerRE matches the hidden metadata marker within an issue body
+	markerRE = regexp.MustCompile(`(?m)\n*^<!-- secureframe-issue-sync: (\{.*\}) -->$`)
+	// legacyIDRE matches the test ID within the metadata section of issues created before the marker existed
+	legacyIDRE = regexp.MustCompile(`Secureframe ID: ([\w-]+)`)
+)
+
+// Metadata is embedded within every issue body as a hidden HTML comment, so that issues can be
+// mapped back to their test regardless of how the rest of the body is rendered or edited.
+type Metadata struct {
+	Version    int      `json:"v"`
+	TestID     string   `json:"testId"`
+	Key        string   `json:"key"`
+	Frameworks []string `json:"frameworks"`
+	// Workspace is the name of the Secureframe workspace the issue was synced from, if any
+	Workspace string `json:"workspace,omitempty"`
+	// Hash is the SHA-256 of the visible content of the managed section, as rendered
+	Hash string `json:"hash"`
+	// SyncVersion is the version of secureframe-issue-sync that rendered the body
+	SyncVersion string `json:"syncVersion"`
+}
+
+// Marker returns the hidden HTML comment holding the metadata
+func (m Metadata) Marker() string {
+	// Only strings and ints, so marshalling can't fail
+	bs, _ := json.Marshal(m)
+	return markerPrefix + string(bs) + markerSuffix
+}
+
+// ParseMetadata returns the metadata embedded in an issue body, which may be of an older version
+func ParseMetadata(body string) (Metadata, bool) {
+	body = normalize(body)
+	// Prefer the marker within the managed section, in case another was pasted elsewhere
+	if start, end, ok := managedRange(body); ok {
+		body = body[start:end]
+	}
+	match := markerRE.FindStringSubmatch(body)
+	if match == nil {
+		return Metadata{}, false
+	}
+
+	m := Metadata{}
+	if err := json.Unmarshal([]byte(match[1]), &m); err != nil || m.TestID == "" {
+		return Metadata{}, false
+	}
+	return m, true
+}
+
+// TestID returns the ID of the test an issue body was rendered for, preferring the metadata marker
+// over the legacy "Secureframe ID" line.
+func TestID(body string) (string, bool) {
+	if m, ok := ParseMetadata(body); ok {
+		return m.TestID, true
+	}
+	if match := legacyIDRE.FindStringSubmatch(body); match != nil {
+		return match[1], true
+	}
+	return "", false
+}
+
+// stripMarker returns an issue body without its metadata marker
+func stripMarker(body string) string {
+	return markerRE.ReplaceAllString(body, "")
+}
+
+// contentHash returns the hash recorded in the metadata for the visible content of a managed section
+func contentHash(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+// HandEdited returns true if the managed section of a body no longer matches the hash recorded when it was rendered,
+// meaning that someone edited it by hand. Such edits are overwritten by the next update.
+func HandEdited(body string) bool {
+	m, ok := ParseMetadata(body)
+	if !ok || m.Hash == "" {
+		return false
+	}
+	return contentHash(managedContent(body)) != m.Hash
+}
+
+// syncVersion returns the version of secureframe-issue-sync, as recorded by the Go toolchain
+func syncVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || bi.Main.Version == "" {
+		return "devel"
+	}
+	return strings.Trim(bi.Main.Version, "()")
+}
+
+// normalize returns a body with Unix line endings, as edits made within the GitHub UI may introduce carriage returns
+func normalize(body string) string {
+	return strings.ReplaceAll(body, "\r\n", "\n")
+}
+
+// managedRange returns the start and end offsets of the managed section of a body, including its markers
+func managedRange(body string) (int, int, bool) {
+	start := strings.Index(body, managedBegin)
+	if start < 0 {
+		return 0, 0, false
+	}
+	end := strings.Index(body[start:], managedEnd)
+	if end < 0 {
+		return 0, 0, false
+	}
+	return start, start + end + len(managedEnd), true
+}
+
+// managedContent returns the visible content of the managed section of a body, without markers.
+// Bodies without a managed section predate it, so are treated as entirely managed.
+func managedContent(body string) string {
+	body = normalize(body)
+	if start, end, ok := managedRange(body); ok {
+		body = body[start+len(managedBegin) : end-len(managedEnd)]
+	}
+	return strings.TrimSpace(stripMarker(body))
+}
+
+// MergeBody replaces the managed section of an existing body with that of a newly rendered body,
+// preserving anything outside of it. Bodies without a managed section are replaced entirely.
+func MergeBody(existing string, rendered string) string {
+	start, end, ok := managedRange(existing)
+	if !ok {
+		return rendered
+	}
+	return existing[:start] + rendered + existing[end:]
+}
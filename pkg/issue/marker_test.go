@@ -0,0 +1,107 @@
+package issue
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+)
+
+// rendered returns the issue rendered for a failing test
+func rendered(t *testing.T, id string, description string) IssueForm {
+	t.Helper()
+	ft, err := FromTest(secureframe.Test{ID: id, Enabled: true, V2: secureframe.TestV2{Key: "key-" + id, Title: "Test " + id, Description: description}}, "", nil, "")
+	if err != nil {
+		t.Fatalf("FromTest(%s): %v", id, err)
+	}
+	return ft
+}
+
+// bumped returns a body whose metadata marker is of an older version
+func bumped(body string) string {
+	return strings.Replace(body, fmt.Sprintf(`{"v":%d,`, MetadataVersion), fmt.Sprintf(`{"v":%d,`, MetadataVersion-1), 1)
+}
+
+func TestParseMetadata(t *testing.T) {
+	body := rendered(t, "a", "").Body
+	other := rendered(t, "b", "").Metadata.Marker()
+
+	tests := []struct {
+		name        string
+		body        string
+		wantOK      bool
+		wantTestID  string
+		wantVersion int
+	}{
+		{name: "rendered", body: body, wantOK: true, wantTestID: "a", wantVersion: MetadataVersion},
+		{name: "text before and after", body: "notes\n\n" + body + "\n\nmore notes", wantOK: true, wantTestID: "a", wantVersion: MetadataVersion},
+		{name: "windows line endings", body: strings.ReplaceAll(body, "\n", "\r\n"), wantOK: true, wantTestID: "a", wantVersion: MetadataVersion},
+		{name: "marker pasted outside the managed block", body: other + "\n\n" + body, wantOK: true, wantTestID: "a", wantVersion: MetadataVersion},
+		{name: "missing end marker", body: strings.Replace(body, managedEnd, "", 1), wantOK: true, wantTestID: "a", wantVersion: MetadataVersion},
+		{name: "older marker version", body: bumped(body), wantOK: true, wantTestID: "a", wantVersion: MetadataVersion - 1},
+		{name: "legacy body without markers", body: "## Metadata\n\n* Secureframe ID: a\n"},
+		{name: "missing marker", body: stripMarker(body)},
+		{name: "invalid marker", body: markerPrefix + "{not json}" + markerSuffix},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, ok := ParseMetadata(tc.body)
+			if ok != tc.wantOK {
+				t.Fatalf("ParseMetadata ok = %v, want %v", ok, tc.wantOK)
+			}
+			if m.TestID != tc.wantTestID || m.Version != tc.wantVersion {
+				t.Errorf("ParseMetadata = %+v, want test ID %q and version %d", m, tc.wantTestID, tc.wantVersion)
+			}
+		})
+	}
+}
+
+func TestTestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		wantID string
+		wantOK bool
+	}{
+		{name: "marker", body: rendered(t, "a", "").Body, wantID: "a", wantOK: true},
+		{name: "legacy body without markers", body: "## Metadata\n\n* Secureframe ID: a-1\n", wantID: "a-1", wantOK: true},
+		{name: "neither", body: "a human wrote this"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok := TestID(tc.body)
+			if id != tc.wantID || ok != tc.wantOK {
+				t.Errorf("TestID = %q, %v, want %q, %v", id, ok, tc.wantID, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestMergeBody(t *testing.T) {
+	before := rendered(t, "a", "before requirement").Body
+	after := rendered(t, "a", "after requirement").Body
+
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{name: "managed block only", existing: before, want: after},
+		{name: "text before and after", existing: "notes\n\n" + before + "\n\n- [ ] checklist", want: "notes\n\n" + after + "\n\n- [ ] checklist"},
+		{name: "legacy body without markers", existing: "## Metadata\n\n* Secureframe ID: a\n", want: after},
+		{name: "missing end marker", existing: "notes\n\n" + strings.Replace(before, managedEnd, "", 1), want: after},
+		{name: "missing begin marker", existing: "notes\n\n" + strings.Replace(before, managedBegin, "", 1), want: after},
+		{name: "older marker version", existing: "notes\n\n" + bumped(before), want: "notes\n\n" + after},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MergeBody(tc.existing, after); got != tc.want {
+				t.Errorf("MergeBody =\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
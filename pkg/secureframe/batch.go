@@ -0,0 +1,115 @@
+package secureframe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// DefaultBatchSize is the number of tests fetched per getCompanyTest request
+var DefaultBatchSize = 10
+
+// idVarRE matches the $id variable within companyTestSelection
+var idVarRE = regexp.MustCompile(`\$id\b`)
+
+// alias returns the GraphQL field alias used for the nth test within a batch
+func alias(n int) string {
+	return fmt.Sprintf("t%d", n)
+}
+
+// batchPayload returns a single request for the first page of details of several tests.
+// Each test is fetched under its own alias (t0, t1, ...), sharing the usual fragments.
+func (c *Client) batchPayload(ids []string) payload {
+	vars := map[string]interface{}{
+		"page":                    1,
+		"limit":                   assertionPageSize,
+		"pass":                    false,
+		"current_company_user_id": c.CompanyID,
+	}
+
+	decls := []string{}
+	fields := []string{}
+	for n, id := range ids {
+		v := fmt.Sprintf("id%d", n)
+		vars[v] = id
+		decls = append(decls, fmt.Sprintf("$%s: ID!", v))
+		fields = append(fields, fmt.Sprintf("%s: getCompanyTest(id: $%s) %s", alias(n), v, idVarRE.ReplaceAllString(companyTestSelection, "$$"+v)))
+	}
+
+	q := fmt.Sprintf("query getCompanyTests(%s, $page: Int, $limit: Int, $pass: Boolean) {\n%s\n}\n\n%s",
+		strings.Join(decls, ", "), strings.Join(fields, "\n"), companyTestFragments)
+
+	return payload{
+		OperationName: "getCompanyTests",
+		Variables:     vars,
+		Query:         q,
+	}
+}
+
+type batchResponse struct {
+	Errors GraphQLErrors              `json:"errors"`
+	Data   map[string]json.RawMessage `json:"data"`
+}
+
+// getCompanyTestBatch returns the details of several tests using a single request, including every page
+// of failing assertion results. Errors that only affect a single test are returned keyed by test ID.
+func (c *Client) getCompanyTestBatch(ctx context.Context, ids []string) (map[string]Test, map[string]error, error) {
+	// No need for aliases when there is only one test
+	if len(ids) == 1 {
+		t, err := c.getCompanyTest(ctx, ids[0])
+		if err != nil {
+			return nil, map[string]error{ids[0]: err}, nil
+		}
+		return map[string]Test{ids[0]: t}, map[string]error{}, nil
+	}
+
+	out := &batchResponse{}
+	if err := c.query(ctx, c.batchPayload(ids), out); err != nil {
+		return nil, nil, fmt.Errorf("request: %w", err)
+	}
+
+	// Errors with a path belong to a single alias: anything else affects the whole batch
+	aliasErrs := map[string]GraphQLErrors{}
+	for _, e := range out.Errors {
+		if len(e.Path) == 0 {
+			return nil, nil, out.Errors
+		}
+		a := fmt.Sprint(e.Path[0])
+		aliasErrs[a] = append(aliasErrs[a], e)
+	}
+
+	tests := map[string]Test{}
+	errs := map[string]error{}
+	for n, id := range ids {
+		a := alias(n)
+		if es := aliasErrs[a]; len(es) > 0 {
+			errs[id] = es
+			continue
+		}
+
+		raw := out.Data[a]
+		if len(raw) == 0 || string(raw) == "null" {
+			errs[id] = fmt.Errorf("no data returned for %s", a)
+			continue
+		}
+
+		t := Test{}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			errs[id] = &SchemaError{Err: err, Body: raw}
+			continue
+		}
+
+		t, err := c.remainingPages(ctx, id, withTotals(t))
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		tests[id] = t
+	}
+
+	log.Printf("fetched %d/%d tests in batch", len(tests), len(ids))
+	return tests, errs, nil
+}
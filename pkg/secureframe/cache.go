@@ -0,0 +1,103 @@
+package secureframe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached responses are used for
+var DefaultCacheTTL = 15 * time.Minute
+
+// cachedOperations are the GraphQL operations whose responses may be cached.
+// The test listing is never cached, so that pass/fail state is always current.
+var cachedOperations = map[string]bool{
+	"getCompanyTest":  true,
+	"getCompanyTests": true,
+}
+
+// Cache stores responses to Secureframe detail queries on disk
+type Cache struct {
+	// Dir is the directory responses are stored in
+	Dir string
+	// TTL is how long a response is used for after it was stored
+	TTL time.Duration
+}
+
+// NewCache returns a cache stored within dir
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// key returns the cache key for a request, based on the endpoint, operation name and variables
+func (c *Cache) key(endpoint string, p payload) (string, error) {
+	vars, err := json.Marshal(p.Variables)
+	if err != nil {
+		return "", fmt.Errorf("marshal: %w", err)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s", endpoint, p.OperationName, vars, p.Query)
+	return p.OperationName + "-" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get returns a cached response, if it exists and has not expired
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	p := c.path(key)
+	fi, err := os.Stat(p)
+	if err != nil || time.Since(fi.ModTime()) > c.TTL {
+		return nil, false
+	}
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	return bs, true
+}
+
+// Put stores a response
+func (c *Cache) Put(key string, bs []byte) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	return os.WriteFile(c.path(key), bs, 0o600)
+}
+
+// Clear removes every cached response
+func (c *Cache) Clear() error {
+	paths, err := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("glob: %w", err)
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove: %w", err)
+		}
+	}
+	log.Printf("removed %d cached responses from %s", len(paths), c.Dir)
+	return nil
+}
+
+// cacheable returns true if a raw response is worth caching: responses with errors never are
+func cacheable(rb []byte) bool {
+	out := struct {
+		Errors []json.RawMessage `json:"errors"`
+	}{}
+	return json.Unmarshal(rb, &out) == nil && len(out.Errors) == 0
+}
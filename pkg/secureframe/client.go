@@ -0,0 +1,189 @@
+package secureframe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultEndpoint  = "https://app.secureframe.com/graphql"
+	DefaultUserAgent = "secureframe-issue-sync"
+
+	DefaultConcurrency       = 4
+	DefaultRequestsPerSecond = 4.0
+)
+
+// Client is a client for the Secureframe GraphQL API
+type Client struct {
+	// Endpoint is the URL that GraphQL queries are POSTed to
+	Endpoint string
+	// HTTPClient is the client used to make requests
+	HTTPClient *http.Client
+	// UserAgent is sent with every request
+	UserAgent string
+	// Token is either a bearer token or a long-lived "<API KEY> <SECRET KEY>" pair
+	Token string
+	// CompanyID is the Secureframe company user ID
+	CompanyID string
+	// Retry controls how failed requests are retried
+	Retry RetryPolicy
+	// Limiter throttles every request made by the client, and may be shared with other clients
+	Limiter *Limiter
+	// Concurrency is the number of requests for test details made in parallel
+	Concurrency int
+	// BatchSize is the number of tests whose details are fetched per request
+	BatchSize int
+	// State, if set, allows the details of unchanged tests to be reused from a previous run.
+	// GetTests updates it with the results of the current run.
+	State *State
+	// FullRefreshInterval is how often every failing test is fetched, even if State says it is unchanged
+	FullRefreshInterval time.Duration
+	// WorkspaceID, if set, scopes the test listing and its health statuses to a Secureframe workspace.
+	// Listing tests fails if the API does not accept the workspace, rather than returning every workspace.
+	WorkspaceID string
+	// CompanyFrameworkID, if set, scopes health statuses to a company framework, and skips tests that are not active within it
+	CompanyFrameworkID string
+	// Filter, if set, selects which tests are returned from the listing
+	Filter *Filter
+	// Excluded, if set, records the tests skipped by Filter or CompanyFrameworkID
+	Excluded *Exclusions
+	// Cache, if set, stores the responses to test detail queries on disk
+	Cache *Cache
+}
+
+// NewClient returns a client for the default Secureframe endpoint
+func NewClient(companyID string, token string) *Client {
+	return &Client{
+		Endpoint:    DefaultEndpoint,
+		HTTPClient:  http.DefaultClient,
+		UserAgent:   DefaultUserAgent,
+		Token:       token,
+		CompanyID:   companyID,
+		Retry:       DefaultRetryPolicy,
+		Limiter:     NewLimiter(DefaultRequestsPerSecond, 1),
+		Concurrency: DefaultConcurrency,
+		BatchSize:   DefaultBatchSize,
+
+		FullRefreshInterval: DefaultFullRefreshInterval,
+	}
+}
+
+// authorization returns the value of the Authorization header for our token
+func (c *Client) authorization() string {
+	if !strings.Contains(c.Token, " ") {
+		return fmt.Sprintf("Bearer %s", c.Token)
+	}
+	return c.Token
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) query(ctx context.Context, in interface{}, out interface{}) error {
+	rb, err := c.queryRaw(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(rb, out); err != nil {
+		return &SchemaError{Err: err, Body: rb}
+	}
+
+	log.Printf("parsed response: %+v", out)
+	return nil
+}
+
+// queryRaw sends a GraphQL request, returning the undecoded response body.
+// Responses to cacheable operations are served from the cache, if one is configured.
+func (c *Client) queryRaw(ctx context.Context, in interface{}) ([]byte, error) {
+	p, ok := in.(payload)
+	if !ok || c.Cache == nil || !cachedOperations[p.OperationName] {
+		return c.post(ctx, in)
+	}
+
+	key, err := c.Cache.key(c.Endpoint, p)
+	if err != nil {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+	if rb, ok := c.Cache.Get(key); ok {
+		log.Printf("using cached %s response: %s", p.OperationName, key)
+		return rb, nil
+	}
+
+	rb, err := c.post(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable(rb) {
+		if err := c.Cache.Put(key, rb); err != nil {
+			log.Printf("unable to cache %s response: %v", p.OperationName, err)
+		}
+	}
+	return rb, nil
+}
+
+// post sends a GraphQL request to the API, returning the undecoded response body
+func (c *Client) post(ctx context.Context, in interface{}) ([]byte, error) {
+	payloadBytes, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	x := fmt.Sprintf("%s", payloadBytes)
+	x = strings.ReplaceAll(x, "\\n", "\n")
+	x = strings.ReplaceAll(x, "\\t", `  `)
+	log.Printf("request payload:\n%s\n", x)
+
+	token := c.authorization()
+	apiKey, _, _ := strings.Cut(token, " ")
+
+	log.Printf("POST to %s with %q token: %d bytes", c.Endpoint, apiKey, len(payloadBytes))
+	resp, err := c.Retry.do(ctx, c.httpClient(), func() (*http.Request, error) {
+		// Every attempt counts against the rate limit, including retries
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		// The body is rebuilt on every attempt, as a previous attempt may have consumed it
+		req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewReader(payloadBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		if c.UserAgent != "" {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	defer resp.Body.Close()
+
+	rb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	log.Printf("response: %s", rb)
+	return rb, nil
+}
@@ -0,0 +1,137 @@
+package secureframe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is returned when the token is invalid or has expired
+	ErrUnauthorized = errors.New("unauthorized: token is invalid or expired")
+	// ErrRateLimited is returned when Secureframe is still throttling requests after retries
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnavailable is returned when Secureframe is still failing after retries
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrSchemaChanged is returned when a response no longer matches what the client expects
+	ErrSchemaChanged = errors.New("schema changed")
+	// ErrTooManyRequests is returned when a single operation would exceed our own request budget
+	ErrTooManyRequests = errors.New("made too many requests")
+)
+
+// StatusError is returned when Secureframe responds with an unexpected HTTP status code
+type StatusError struct {
+	StatusCode int
+	// Attempts is the number of attempts made before giving up
+	Attempts int
+}
+
+func (e *StatusError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("unexpected status code: %d (gave up after %d attempts)", e.StatusCode, e.Attempts)
+	}
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// GraphQLError is an error returned within a GraphQL response body
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := []string{}
+	for _, p := range e.Path {
+		path = append(path, fmt.Sprint(p))
+	}
+	return fmt.Sprintf("%s (path: %s)", e.Message, strings.Join(path, "."))
+}
+
+// Code returns the error code from the extensions, if any
+func (e *GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+func (e *GraphQLError) Is(target error) bool {
+	code := strings.ToUpper(e.Code())
+	msg := strings.ToLower(e.Message)
+
+	switch target {
+	case ErrUnauthorized:
+		return code == "UNAUTHENTICATED" || code == "FORBIDDEN" || strings.Contains(msg, "not authorized") || strings.Contains(msg, "unauthorized")
+	case ErrRateLimited:
+		return code == "RATE_LIMITED" || strings.Contains(msg, "rate limit")
+	case ErrSchemaChanged:
+		return code == "GRAPHQL_VALIDATION_FAILED" || code == "UNDEFINEDFIELD" ||
+			strings.Contains(msg, "cannot query field") || strings.Contains(msg, "doesn't exist on type") ||
+			strings.Contains(msg, "doesn't accept argument") || strings.Contains(msg, "unknown type")
+	}
+	return false
+}
+
+// GraphQLErrors is the list of errors returned within a GraphQL response body
+type GraphQLErrors []*GraphQLError
+
+func (es GraphQLErrors) Error() string {
+	msgs := []string{}
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("API returned errors: %s", strings.Join(msgs, "; "))
+}
+
+func (es GraphQLErrors) Is(target error) bool {
+	for _, e := range es {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As allows errors.As to find the first GraphQLError within the list
+func (es GraphQLErrors) As(target interface{}) bool {
+	t, ok := target.(**GraphQLError)
+	if !ok || len(es) == 0 {
+		return false
+	}
+	*t = es[0]
+	return true
+}
+
+// SchemaError is returned when a response cannot be decoded into the expected types
+type SchemaError struct {
+	Err error
+	// Body is the response that could not be decoded
+	Body []byte
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("unmarshal output: %v\ncontents: %s", e.Err, e.Body)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrSchemaChanged
+}
@@ -0,0 +1,172 @@
+package secureframe
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Criteria lists patterns for each attribute of a test that may be filtered on.
+// Patterns are case-insensitive globs, such as "cloud*", or regular expressions wrapped in slashes, such as "/^(device|personnel)$/".
+type Criteria struct {
+	Domains            []string
+	Functions          []string
+	Types              []string
+	ResourceCategories []string
+	Tags               []string
+	Owners             []string
+	Keys               []string
+}
+
+// Filter selects tests by their attributes. A test is selected if, for every attribute with include patterns,
+// it matches at least one of them, and it matches none of the exclude patterns.
+type Filter struct {
+	include compiledCriteria
+	exclude compiledCriteria
+}
+
+type compiledCriteria [][]pattern
+
+// attributes returns the values of each attribute of a test, in the same order as Criteria
+func attributes(t Test) [][]string {
+	owner := []string{}
+	if t.Owner != nil {
+		owner = append(owner, t.Owner.Name, t.Owner.ID)
+	}
+	key := t.V2.Key
+	if key == "" {
+		key = t.Key
+	}
+	return [][]string{
+		{t.V2.TestDomain},
+		{t.V2.TestFunction},
+		{t.V2.TestType},
+		{t.V2.ResourceCategory},
+		t.Tags,
+		owner,
+		{key},
+	}
+}
+
+// NewFilter returns a filter for the given include and exclude patterns
+func NewFilter(include Criteria, exclude Criteria) (*Filter, error) {
+	in, err := include.compile()
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	ex, err := exclude.compile()
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return &Filter{include: in, exclude: ex}, nil
+}
+
+func (c Criteria) compile() (compiledCriteria, error) {
+	cc := compiledCriteria{}
+	for _, ss := range [][]string{c.Domains, c.Functions, c.Types, c.ResourceCategories, c.Tags, c.Owners, c.Keys} {
+		ps := []pattern{}
+		for _, s := range ss {
+			p, err := parsePattern(s)
+			if err != nil {
+				return nil, err
+			}
+			ps = append(ps, p)
+		}
+		cc = append(cc, ps)
+	}
+	return cc, nil
+}
+
+// Match returns true if a test is selected by the filter. A nil filter selects every test.
+func (f *Filter) Match(t Test) bool {
+	if f == nil {
+		return true
+	}
+
+	for x, vals := range attributes(t) {
+		if len(f.include[x]) > 0 && !matchAny(f.include[x], vals) {
+			return false
+		}
+		if matchAny(f.exclude[x], vals) {
+			return false
+		}
+	}
+	return true
+}
+
+// Exclusions records tests that exist but were skipped by a Filter or company framework, so that their issues
+// can be told apart from those of tests that no longer exist
+type Exclusions struct {
+	mu      sync.Mutex
+	reasons map[string]string
+}
+
+// NewExclusions returns an empty set of exclusions
+func NewExclusions() *Exclusions {
+	return &Exclusions{reasons: map[string]string{}}
+}
+
+// Add records that a test was skipped, and why
+func (e *Exclusions) Add(id string, reason string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reasons[id] = reason
+}
+
+// Reason returns why a test was skipped, if it was
+func (e *Exclusions) Reason(id string) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.reasons[id]
+	return r, ok
+}
+
+// pattern is a glob or a regular expression
+type pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func parsePattern(s string) (pattern, error) {
+	if len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return pattern{}, fmt.Errorf("regexp %q: %w", s, err)
+		}
+		return pattern{re: re}, nil
+	}
+
+	glob := strings.ToLower(s)
+	if _, err := path.Match(glob, ""); err != nil {
+		return pattern{}, fmt.Errorf("glob %q: %w", s, err)
+	}
+	return pattern{glob: glob}, nil
+}
+
+func (p pattern) match(v string) bool {
+	if p.re != nil {
+		return p.re.MatchString(v)
+	}
+	ok, _ := path.Match(p.glob, strings.ToLower(v))
+	return ok
+}
+
+// matchAny returns true if any pattern matches any value
+func matchAny(ps []pattern, vals []string) bool {
+	for _, p := range ps {
+		for _, v := range vals {
+			if v != "" && p.match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package secureframe
+
+// Frameworks returns the frameworks a test applies to, limited to the given report keys.
+// If no report keys are given, every framework the test applies to is returned.
+func (t Test) Frameworks(reportKeys []string) []Framework {
+	wanted := map[string]bool{}
+	for _, k := range reportKeys {
+		wanted[k] = true
+	}
+
+	seen := map[string]bool{}
+	fs := []Framework{}
+	for _, c := range t.V2.ControlV2s {
+		for _, f := range c.Frameworks {
+			if seen[f.Key] || (len(wanted) > 0 && !wanted[f.Key]) {
+				continue
+			}
+			seen[f.Key] = true
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// inReports returns true if a test maps to a control within any of the reports
+func inReports(t Test, reportKeys []string) bool {
+	return len(reportKeys) == 0 || len(t.Frameworks(reportKeys)) > 0
+}
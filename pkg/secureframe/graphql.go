@@ -1,27 +1,28 @@
 package secureframe
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"strings"
 	"time"
 )
 
+var ErrUnsupportedType = errors.New("unsupported type")
+
 var (
-	ErrUnsupportedType = errors.New("unsupported type")
-	defaultEndpoint    = "https://app.secureframe.com/graphql"
+	// assertionPageSize is the number of assertion results requested per page
+	assertionPageSize = 500
+	// maxAssertionPages caps the number of assertion result pages fetched per test
+	maxAssertionPages = 40
 )
 
 type payload struct {
-	OperationName string    `json:"operationName"`
-	Variables     variables `json:"variables"`
-	Query         string    `json:"query"`
+	OperationName string      `json:"operationName"`
+	Variables     interface{} `json:"variables"`
+	Query         string      `json:"query"`
 }
 
 type searchBy struct {
@@ -55,6 +56,10 @@ type variables struct {
 	Pass bool    `json:"pass"`
 
 	Key string `json:"key"`
+
+	// Used by GetCompanyTestV2sQuery to scope the listing and its health statuses
+	CompanyFrameworkID string `json:"companyFrameworkId,omitempty"`
+	WorkspaceID        string `json:"workspaceId,omitempty"`
 }
 
 type field struct {
@@ -81,10 +86,6 @@ type where struct {
 	Combinator combinator `json:"combinator,omitempty"`
 }
 
-type Error struct {
-	Message string
-}
-
 type getCompanyTestsData struct {
 	SearchCompanyTests dataCollection `json:"searchCompanyTests"`
 }
@@ -94,12 +95,12 @@ type dataCollection struct {
 }
 
 type getCompanyTestsResponse struct {
-	Errors []Error             `json:"errors"`
+	Errors GraphQLErrors       `json:"errors"`
 	Data   getCompanyTestsData `json:"data"`
 }
 
 type getCompanyTestResponse struct {
-	Errors []Error            `json:"errors"`
+	Errors GraphQLErrors      `json:"errors"`
 	Data   getCompanyTestData `json:"data"`
 }
 
@@ -144,6 +145,10 @@ func (sa *StringOrArray) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	switch obj := jsonObj.(type) {
+	case nil:
+		// Written by encoding/json when re-encoding an empty value, such as within a snapshot
+		*sa = nil
+		return nil
 	case string:
 		*sa = StringOrArray([]string{obj})
 		return nil
@@ -226,7 +231,14 @@ type AssertionResult struct {
 }
 
 type AssertionResults struct {
-	Collection []AssertionResult `json:"collection"`
+	Collection []AssertionResult   `json:"collection"`
+	Metadata   *assertionsMetadata `json:"metadata,omitempty"`
+}
+
+type assertionsMetadata struct {
+	metadata
+	TotalFailingAssertions int `json:"totalFailingAssertions,omitempty"`
+	TotalAssertions        int `json:"totalAssertions,omitempty"`
 }
 
 type Test struct {
@@ -243,11 +255,104 @@ type Test struct {
 	AssertionKeys    []string         `json:"assertionKeys"`
 	AssertionResults AssertionResults `json:"assertionResults"`
 	Title            string           `json:"title"`
-	EvidenceType     string           `json:"evidenceType"`
+
+	// Totals across every page of assertion results, which may be more than were fetched
+	TotalAssertions        int    `json:"totalAssertions"`
+	TotalFailingAssertions int    `json:"totalFailingAssertions"`
+	EvidenceType           string `json:"evidenceType"`
+
+	Owner                  *User    `json:"owner"`
+	Status                 string   `json:"status"`
+	Tags                   []string `json:"tags"`
+	UpdatedAt              Time     `json:"updatedAt"`
+	LastEvaluated          Time     `json:"lastEvaluated"`
+	LastPassedAt           Time     `json:"lastPassedAt"`
+	FirstFailedAt          Time     `json:"firstFailedAt"`
+	NextDueDate            Time     `json:"nextDueDate"`
+	ToleranceWindowSeconds int      `json:"toleranceWindowSeconds"`
+	TestIntervalSeconds    int      `json:"testIntervalSeconds"`
+
+	// The following fields are only returned when listing tests
+	HealthStatuses              []HealthStatus     `json:"healthStatuses"`
+	ActiveCompanyFrameworks     []CompanyFramework `json:"activeCompanyFrameworks"`
+	UnarchivedAttachedEvidences []Evidence         `json:"unarchivedAttachedEvidences"`
+
+	// The following fields are only returned if getTest is called
+	AttachedEvidences []AttachedEvidence `json:"attachedEvidences"`
 
 	V2 TestV2 `json:"testV2"`
 }
 
+// FailingCount returns the total number of failing assertions, even if not all of them were fetched
+func (t Test) FailingCount() int {
+	if t.TotalFailingAssertions > len(t.AssertionResults.Collection) {
+		return t.TotalFailingAssertions
+	}
+	return len(t.AssertionResults.Collection)
+}
+
+// InCompanyFramework returns true if a test is active within the given company framework
+func (t Test) InCompanyFramework(id string) bool {
+	for _, cf := range t.ActiveCompanyFrameworks {
+		if cf.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ToleranceWindow is how long a test may fail before it is considered overdue
+func (t Test) ToleranceWindow() time.Duration {
+	return time.Duration(t.ToleranceWindowSeconds) * time.Second
+}
+
+// TestInterval is how often a test is evaluated
+func (t Test) TestInterval() time.Duration {
+	return time.Duration(t.TestIntervalSeconds) * time.Second
+}
+
+type User struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"imageUrl"`
+}
+
+type Vendor struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+type CompanyFramework struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+// HealthStatus is the status of a test within a single framework
+type HealthStatus struct {
+	ID               string            `json:"id"`
+	Status           string            `json:"status"`
+	Framework        *Framework        `json:"framework"`
+	CompanyFramework *CompanyFramework `json:"companyFramework"`
+}
+
+type FileNode struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DiscardedAt Time   `json:"discardedAt"`
+}
+
+type Evidence struct {
+	ID       string          `json:"id"`
+	Files    json.RawMessage `json:"files,omitempty"`
+	FileNode *FileNode       `json:"fileNode"`
+}
+
+type AttachedEvidence struct {
+	Evidence Evidence `json:"evidence"`
+}
+
 type Control struct {
 	ID          string `json:"id"`
 	Key         string `json:"key"`
@@ -262,8 +367,11 @@ type ControlV2 struct {
 }
 
 type Framework struct {
-	Key   string `json:"key"`
-	Label string `json:"label"`
+	ID       string `json:"id"`
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Name     string `json:"name"`
+	TagLabel string `json:"tagLabel"`
 }
 
 type TestV2 struct {
@@ -283,6 +391,9 @@ type TestV2 struct {
 	TestType         string `json:"testType"`
 	ResourceCategory string `json:"resourceCategory"`
 
+	Vendor *Vendor `json:"vendor"`
+	Author *User   `json:"author"`
+
 	DetailedRemediationSteps string `json:"detailedRemediationSteps"`
 	RecommendedAction        string `json:"recommendedAction"`
 
@@ -291,82 +402,341 @@ type TestV2 struct {
 	Status string `json:"status"`
 }
 
-func query(ctx context.Context, token string, in interface{}, out interface{}) error {
-	payloadBytes, err := json.Marshal(in)
+// getCompanyTest returns the details of a test, including every page of failing assertion results
+func (c *Client) getCompanyTest(ctx context.Context, id string) (Test, error) {
+	t, err := c.getCompanyTestPage(ctx, id, 1)
 	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+		return t, err
 	}
+	return c.remainingPages(ctx, id, t)
+}
 
-	x := fmt.Sprintf("%s", payloadBytes)
-	x = strings.ReplaceAll(x, "\\n", "\n")
-	x = strings.ReplaceAll(x, "\\t", `  `)
-	log.Printf("request payload:\n%s\n", x)
-	body := bytes.NewReader(payloadBytes)
+// remainingPages fetches the assertion results after the first page, appending them to t
+func (c *Client) remainingPages(ctx context.Context, id string, t Test) (Test, error) {
+	meta := t.AssertionResults.Metadata
+	if meta == nil {
+		return t, nil
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", defaultEndpoint, body)
-	if err != nil {
-		return fmt.Errorf("post: %w", err)
+	// Secondary protection to avoid accidentally DoS'ing Secureframe
+	totalPages := meta.TotalPages
+	if totalPages > maxAssertionPages {
+		log.Printf("test %s has %d pages of assertion results: only fetching %d", id, totalPages, maxAssertionPages)
+		totalPages = maxAssertionPages
+	}
+
+	for page := 2; page <= totalPages; page++ {
+		log.Printf("fetching page %d/%d of assertion results for %s", page, totalPages, id)
+		pt, err := c.getCompanyTestPage(ctx, id, page)
+		if err != nil {
+			return t, fmt.Errorf("page %d: %w", page, err)
+		}
+		t.AssertionResults.Collection = append(t.AssertionResults.Collection, pt.AssertionResults.Collection...)
 	}
 
-	if !strings.Contains(token, " ") {
-		token = fmt.Sprintf("Bearer %s", token)
+	return t, nil
+}
+
+// getCompanyTestPage returns the details of a test, along with a single page of failing assertion results
+func (c *Client) getCompanyTestPage(ctx context.Context, id string, page int) (Test, error) {
+	in := c.companyTestPayload(id, page)
+	out := &getCompanyTestResponse{}
+	if err := c.query(ctx, in, out); err != nil {
+		return Test{}, fmt.Errorf("request: %w", err)
 	}
 
-	apiKey, _, _ := strings.Cut(token, " ")
+	if len(out.Errors) > 0 {
+		return Test{}, out.Errors
+	}
 
-	req.Header.Set("Authorization", token)
-	req.Header.Set("Content-Type", "application/json")
+	t := withTotals(out.Data.Test)
+	log.Printf("out.Data: %+v", t)
+	return t, nil
+}
 
-	log.Printf("POST to %s with %q token: %d bytes", defaultEndpoint, apiKey, len(payloadBytes))
+// withTotals copies the assertion result totals from the page metadata onto the test
+func withTotals(t Test) Test {
+	if meta := t.AssertionResults.Metadata; meta != nil {
+		t.TotalAssertions = meta.TotalAssertions
+		t.TotalFailingAssertions = meta.TotalFailingAssertions
+	}
+	return t
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("do: %w", err)
+// companyTestPayload returns the request for a single test, with a page of failing assertion results
+func (c *Client) companyTestPayload(id string, page int) payload {
+	return payload{
+		OperationName: "getCompanyTest",
+		Variables: variables{
+			ID:                   &id,
+			Page:                 page,
+			Limit:                assertionPageSize,
+			Pass:                 false,
+			CurrentCompanyUserID: c.CompanyID,
+		},
+		Query: companyTestQuery,
 	}
+}
 
-	if resp.StatusCode >= 500 {
-		log.Printf("unexpected status code: %d (will retry)", resp.StatusCode)
-		time.Sleep(2 * time.Second)
+// ListTests returns all tests for the given report keys, without the details of failing tests
+func (c *Client) ListTests(ctx context.Context, reportKeys []string) ([]Test, error) {
+	log.Printf("Listing Secureframe tests for %s ...", reportKeys)
 
-		resp, err = http.DefaultClient.Do(req)
+	page := 0
+	totalPages := 1
+	maxRequests := 50
+	requestCount := 0
+
+	found := []Test{}
+	seen := map[string]bool{}
+	for page < totalPages {
+		page++
+
+		// Secondary protection to avoid accidentally DoS'ing Secureframe
+		requestCount++
+		if requestCount > maxRequests {
+			return found, ErrTooManyRequests
+		}
+
+		ts, meta, err := c.getCompanyTestV2s(ctx, reportKeys, page)
 		if err != nil {
-			return fmt.Errorf("do: %w", err)
+			return nil, fmt.Errorf("get company test v2s: %w", err)
+		}
+
+		// Tests that apply to multiple frameworks should only be synced once
+		for _, t := range ts {
+			if seen[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+			found = append(found, t)
+		}
+		//time.Sleep(time.Duration(page) * time.Second)
+
+		totalPages = meta.TotalPages
+		page = meta.CurrentPage
+	}
+
+	return found, nil
+}
+
+// GetTests returns all tests for the given report keys, with details filled in for failing tests
+func (c *Client) GetTests(ctx context.Context, reportKeys []string) ([]Test, error) {
+	found, err := c.ListTests(ctx, reportKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("got data on %d tests ... filling in", len(found))
+	// The remaining bit of this function is a hack to fill in more information for failing tests.
+	// If we had a properly documented GraphQL API, we could get everything in a single query.
+	// Results are written by index so that the order matches the listing, regardless of which worker finishes first.
+	detailed := make([]Test, len(found))
+	failing := []int{}
+	full := c.State.needsFullRefresh(c.FullRefreshInterval)
+	reused := 0
+	for x, t := range found {
+		// No need for details in these cases
+		if t.Pass || !t.Enabled {
+			detailed[x] = t
+			continue
 		}
+
+		// Unchanged since the last run, so the previous details are still good
+		if ct, ok := c.State.cached(t); ok && !full {
+			detailed[x] = ct
+			reused++
+			continue
+		}
+		failing = append(failing, x)
 	}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if c.State != nil {
+		log.Printf("reusing details for %d unchanged failing tests (full refresh: %v)", reused, full)
 	}
 
-	defer resp.Body.Close()
+	// Failing tests are fetched in batches, each of which is a single request
+	size := c.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	batches := [][]int{}
+	for len(failing) > 0 {
+		n := size
+		if n > len(failing) {
+			n = len(failing)
+		}
+		batches = append(batches, failing[:n])
+		failing = failing[n:]
+	}
+
+	err = forEach(ctx, len(batches), c.Concurrency, func(ctx context.Context, n int) error {
+		ids := []string{}
+		for _, x := range batches[n] {
+			ids = append(ids, found[x].ID)
+		}
+
+		log.Printf("[%d/%d] Fetching detailed data for failing tests: %s", n+1, len(batches), ids)
+		mts, errs, err := c.getCompanyTestBatch(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("get company tests (%s): %w", ids, err)
+		}
 
-	rb, err := io.ReadAll(resp.Body)
+		for _, x := range batches[n] {
+			t := found[x]
+			if err := errs[t.ID]; err != nil {
+				return fmt.Errorf("get company test (%s): %w", t.ID, err)
+			}
+			detailed[x] = mergeListing(mts[t.ID], t)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("read: %w", err)
+		return nil, err
+	}
+
+	if c.State != nil {
+		c.State.record(found, detailed, full)
+	}
+	return detailed, nil
+}
+
+// mergeListing fills in fields that the detail query does not return from the listing of a test
+func mergeListing(detail Test, listing Test) Test {
+	if len(detail.V2.ControlV2s) == 0 {
+		detail.V2.ControlV2s = listing.V2.ControlV2s
+	}
+	if len(detail.Tags) == 0 {
+		detail.Tags = listing.Tags
+	}
+	if len(detail.HealthStatuses) == 0 {
+		detail.HealthStatuses = listing.HealthStatuses
+	}
+	if len(detail.ActiveCompanyFrameworks) == 0 {
+		detail.ActiveCompanyFrameworks = listing.ActiveCompanyFrameworks
+	}
+	if len(detail.UnarchivedAttachedEvidences) == 0 {
+		detail.UnarchivedAttachedEvidences = listing.UnarchivedAttachedEvidences
+	}
+	if detail.V2.Vendor == nil {
+		detail.V2.Vendor = listing.V2.Vendor
 	}
+	return detail
+}
 
-	log.Printf("response: %s", rb)
+func (c *Client) getCompanyTestV2s(ctx context.Context, reportKeys []string, pageNumber int) ([]Test, *metadata, error) {
+	in := c.companyTestV2sPayload(pageNumber)
+	out := &getCompanyTestsResponse{}
+	if err := c.query(ctx, in, out); err != nil {
+		return nil, nil, fmt.Errorf("query: %w", err)
+	}
 
-	if err := json.Unmarshal(rb, out); err != nil {
-		return fmt.Errorf("unmarshal output: %w\ncontents: %s", err, rb)
+	if len(out.Errors) > 0 {
+		// An API that cannot scope the listing by workspace rejects it outright, rather than returning every workspace
+		if c.WorkspaceID != "" {
+			return nil, nil, fmt.Errorf("test listing scoped to workspace %s (the API may not support --workspace-id): %w", c.WorkspaceID, out.Errors)
+		}
+		return nil, nil, out.Errors
+	}
+
+	meta := out.Data.SearchCompanyTests.Data.Metadata
+	log.Printf("response metadata: %+v", meta)
+	log.Printf("API returned %d results", len(out.Data.SearchCompanyTests.Data.Collection))
+	log.Printf("filtering out tests that do not match reportKeys=%s", reportKeys)
+	// The API no longer appears to filter out report keys 🤷
+	tests := []Test{}
+	filtered := 0
+	for _, t := range out.Data.SearchCompanyTests.Data.Collection {
+		if !inReports(t, reportKeys) {
+			continue
+		}
+		if c.CompanyFrameworkID != "" && !t.InCompanyFramework(c.CompanyFrameworkID) {
+			c.Excluded.Add(t.ID, "test is not active within the company framework")
+			continue
+		}
+		if !c.Filter.Match(t) {
+			c.Excluded.Add(t.ID, "test is excluded by the include/exclude patterns")
+			filtered++
+			continue
+		}
+		tests = append(tests, t)
+	}
+	if filtered > 0 {
+		log.Printf("filtered out %d tests that do not match the include/exclude patterns", filtered)
 	}
 
-	log.Printf("parsed response: %+v", out)
-	return nil
+	return tests, meta, nil
 }
 
-func getCompanyTest(ctx context.Context, companyID string, token string, id string) (Test, error) {
-	in := payload{
-		OperationName: "getCompanyTest",
+// companyTestV2sPayload returns the request for a page of the test listing
+func (c *Client) companyTestV2sPayload(pageNumber int) payload {
+	query := companyTestV2sQuery
+	if c.WorkspaceID != "" {
+		// The argument is only sent when needed, so that listing every workspace never depends on it
+		query = strings.Replace(query, "searchCompanyTests(searchkick: $searchkick)", "searchCompanyTests(searchkick: $searchkick, workspaceId: $workspaceId)", 1)
+	}
+
+	return payload{
+		OperationName: "GetCompanyTestV2sQuery",
 		Variables: variables{
-			ID:                   &id,
-			Page:                 1,
-			Limit:                3000,
-			Pass:                 false,
-			CurrentCompanyUserID: companyID,
+			SearchKick: &searchKick{
+				Page:    pageNumber,
+				PerPage: 100,
+				Query:   "*",
+			},
+			CurrentCompanyUserID: c.CompanyID,
+			CompanyFrameworkID:   c.CompanyFrameworkID,
+			WorkspaceID:          c.WorkspaceID,
+			Where: &where{
+				Type: "combinator",
+				Combinator: combinator{
+					Combinator: "and",
+					Rules: []rule{
+						rule{
+							Type: "field",
+							Not:  false,
+							Field: field{
+								Field:    "discarded_at",
+								Operator: "exists",
+							},
+						},
+						rule{
+							Type: "field",
+							Not:  false,
+							Field: field{
+								Field:    "visible",
+								Operator: "eq",
+								Visible:  true,
+							},
+						},
+						rule{
+							Type: "field",
+							Not:  false,
+							Field: field{
+								Field:    "promoted",
+								Operator: "eq",
+								Promoted: true,
+							},
+						},
+						rule{
+							Type: "field",
+							Not:  false,
+							Field: field{
+								Field:    "enabled",
+								Operator: "eq",
+								Promoted: true,
+							},
+						},
+					},
+				},
+			},
 		},
-		Query: `query getCompanyTest($id: ID!, $page: Int, $limit: Int, $pass: Boolean) {
-			getCompanyTest(id: $id) {
+		Query: query,
+	}
+}
+
+// companyTestSelection is the selection made for a single test, where $id is the ID of the test
+const companyTestSelection = `{
 			  ...CompanyTestType
 			  attachedEvidences {
 				evidence {
@@ -398,10 +768,10 @@ func getCompanyTest(ctx context.Context, companyID string, token string, id stri
 				__typename
 			  }
 			  __typename
-			}
-		  }
+			}`
 
-		  fragment CompanyTestType on CompanyTest {
+// companyTestFragments are the fragments used by companyTestSelection
+const companyTestFragments = `fragment CompanyTestType on CompanyTest {
 			id
 			pass
 			enabled
@@ -597,129 +967,15 @@ func getCompanyTest(ctx context.Context, companyID string, token string, id stri
 			  openedAt
 			  __typename
 			}
-		  }`,
-	}
+		  }`
 
-	out := &getCompanyTestResponse{}
-	if err := query(ctx, token, in, out); err != nil {
-		return Test{}, fmt.Errorf("request: %w", err)
-	}
-
-	if len(out.Errors) > 0 {
-		return Test{}, fmt.Errorf("API returned errors: %+v", out.Errors)
-	}
-
-	log.Printf("out.Data: %+v", out.Data.Test)
-	return out.Data.Test, nil
-}
-
-func GetTests(ctx context.Context, companyID string, token string, reportKey string) ([]Test, error) {
-	log.Printf("Getting Secureframe tests for %s ...", reportKey)
-
-	page := 0
-	totalPages := 1
-	maxRequests := 50
-	requestCount := 0
-
-	found := []Test{}
-	for page < totalPages {
-		page++
-
-		// Secondary protection to avoid accidentally DoS'ing Secureframe
-		requestCount++
-		if requestCount > maxRequests {
-			return found, fmt.Errorf("made too many requests")
-		}
-
-		ts, meta, err := getCompanyTestV2s(ctx, companyID, token, reportKey, page)
-		if err != nil {
-			return nil, fmt.Errorf("get company test v2s: %w", err)
-		}
-		found = append(found, ts...)
-		//time.Sleep(time.Duration(page) * time.Second)
-
-		totalPages = meta.TotalPages
-		page = meta.CurrentPage
-	}
-
-	log.Printf("got data on %d tests ... filling in", len(found))
-	// The remaining bit of this function is a hack to fill in more information for failing tests.
-	// If we had a properly documented GraphQL API, we could get everything in a single query.
-	detailed := []Test{}
-
-	for x, t := range found {
-		// No need for details in these cases
-		if t.Pass || !t.Enabled {
-			detailed = append(detailed, t)
-			continue
-		}
+var companyTestQuery = `query getCompanyTest($id: ID!, $page: Int, $limit: Int, $pass: Boolean) {
+			getCompanyTest(id: $id) ` + companyTestSelection + `
+		  }
 
-		log.Printf("[%d/%d] Fetching detailed data for failing test %s: %+v", x, len(found), t.ID, t)
-		mt, err := getCompanyTest(ctx, companyID, token, t.ID)
-		if err != nil {
-			return nil, fmt.Errorf("get company test (%s): %w", t.ID, err)
-		}
-		time.Sleep(250 * time.Millisecond)
-		detailed = append(detailed, mt)
-	}
-	return detailed, nil
-}
+		  ` + companyTestFragments
 
-func getCompanyTestV2s(ctx context.Context, companyID string, token string, reportKey string, pageNumber int) ([]Test, *metadata, error) {
-	in := payload{
-		OperationName: "GetCompanyTestV2sQuery",
-		Variables: variables{
-			SearchKick: &searchKick{
-				Page:    pageNumber,
-				PerPage: 100,
-				Query:   "*",
-			},
-			CurrentCompanyUserID: companyID,
-			Where: &where{
-				Type: "combinator",
-				Combinator: combinator{
-					Combinator: "and",
-					Rules: []rule{
-						rule{
-							Type: "field",
-							Not:  false,
-							Field: field{
-								Field:    "discarded_at",
-								Operator: "exists",
-							},
-						},
-						rule{
-							Type: "field",
-							Not:  false,
-							Field: field{
-								Field:    "visible",
-								Operator: "eq",
-								Visible:  true,
-							},
-						},
-						rule{
-							Type: "field",
-							Not:  false,
-							Field: field{
-								Field:    "promoted",
-								Operator: "eq",
-								Promoted: true,
-							},
-						},
-						rule{
-							Type: "field",
-							Not:  false,
-							Field: field{
-								Field:    "enabled",
-								Operator: "eq",
-								Promoted: true,
-							},
-						},
-					},
-				},
-			},
-		},
-		Query: `fragment GetCompanyTestV2s_TestV2Fragment on TestV2 {
+const companyTestV2sQuery = `fragment GetCompanyTestV2s_TestV2Fragment on TestV2 {
 		id
 		key
 		title
@@ -840,35 +1096,4 @@ func getCompanyTestV2s(ctx context.Context, companyID string, token string, repo
 		  }
 		  __typename
 		}
-	  }`,
-	}
-
-	out := &getCompanyTestsResponse{}
-	if err := query(ctx, token, in, out); err != nil {
-		return nil, nil, fmt.Errorf("query: %w", err)
-	}
-
-	if len(out.Errors) > 0 {
-		return nil, nil, fmt.Errorf("API returned errors: %+v", out.Errors)
-	}
-
-	meta := out.Data.SearchCompanyTests.Data.Metadata
-	log.Printf("response metadata: %+v", meta)
-	log.Printf("API returned %d results", len(out.Data.SearchCompanyTests.Data.Collection))
-	log.Printf("filtering out tests that match reportKey=%s", reportKey)
-	// The API no longer appears to filter out report keys 🤷
-	tests := []Test{}
-	for _, t := range out.Data.SearchCompanyTests.Data.Collection {
-		for _, c := range t.V2.ControlV2s {
-			for _, f := range c.Frameworks {
-				if f.Key != reportKey {
-					continue
-				}
-				tests = append(tests, t)
-				continue
-			}
-		}
-	}
-
-	return tests, meta, nil
-}
+	  }`
@@ -0,0 +1,157 @@
+package secureframe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// introspectedTypes are the GraphQL types that our queries select fields from
+var introspectedTypes = []string{
+	"AssertionResult",
+	"CloudResource",
+	"CompanyFramework",
+	"CompanyTest",
+	"CompanyUser",
+	"Control",
+	"ControlV2",
+	"Device",
+	"Evidence",
+	"Framework",
+	"Report",
+	"Repository",
+	"TestV2",
+	"Vendor",
+}
+
+type typeRef struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	OfType *typeRef `json:"ofType"`
+}
+
+// String renders a type reference in GraphQL notation, such as "[TestV2!]!"
+func (t *typeRef) String() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+type introspectionField struct {
+	Name string   `json:"name"`
+	Type *typeRef `json:"type"`
+}
+
+type introspectionType struct {
+	Name   string               `json:"name"`
+	Kind   string               `json:"kind"`
+	Fields []introspectionField `json:"fields"`
+}
+
+type introspectionResponse struct {
+	Errors GraphQLErrors `json:"errors"`
+	Data   struct {
+		Schema struct {
+			Types []introspectionType `json:"types"`
+		} `json:"__schema"`
+	} `json:"data"`
+}
+
+const introspectionQuery = `query IntrospectionQuery {
+	__schema {
+	  types {
+		name
+		kind
+		fields(includeDeprecated: true) {
+		  name
+		  type {
+			kind
+			name
+			ofType {
+			  kind
+			  name
+			  ofType {
+				kind
+				name
+				ofType {
+				  kind
+				  name
+				}
+			  }
+			}
+		  }
+		}
+	  }
+	}
+  }`
+
+// Introspect returns the fields of the GraphQL types that our queries depend on, as a shape such as
+// "CompanyTest.pass": "Boolean!". Secureframe may disable introspection at any time.
+func (c *Client) Introspect(ctx context.Context) (Shape, error) {
+	in := struct {
+		OperationName string `json:"operationName"`
+		Query         string `json:"query"`
+	}{
+		OperationName: "IntrospectionQuery",
+		Query:         introspectionQuery,
+	}
+
+	out := &introspectionResponse{}
+	if err := c.query(ctx, in, out); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	if len(out.Errors) > 0 {
+		return nil, out.Errors
+	}
+
+	wanted := map[string]bool{}
+	for _, t := range introspectedTypes {
+		wanted[t] = true
+	}
+
+	s := Shape{}
+	for _, t := range out.Data.Schema.Types {
+		if !wanted[t.Name] {
+			continue
+		}
+		s[t.Name] = t.Kind
+		for _, f := range t.Fields {
+			s[t.Name+"."+f.Name] = f.Type.String()
+		}
+	}
+	return s, nil
+}
+
+// CompareSnapshots returns how an introspection result differs from a stored snapshot:
+// added fields are reported as unknown, and removed fields as missing.
+func CompareSnapshots(snapshot Shape, current Shape) Drift {
+	d := Drift{}
+	for k, v := range current {
+		old, ok := snapshot[k]
+		if !ok {
+			d.Unknown = append(d.Unknown, k)
+			continue
+		}
+		if old != v {
+			d.Changed = append(d.Changed, FieldChange{Path: k, Expected: old, Actual: v})
+		}
+	}
+	for k := range snapshot {
+		if _, ok := current[k]; !ok {
+			d.Missing = append(d.Missing, k)
+		}
+	}
+
+	sort.Strings(d.Unknown)
+	sort.Strings(d.Missing)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Path < d.Changed[j].Path })
+	return d
+}
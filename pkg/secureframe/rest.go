@@ -0,0 +1,360 @@
+package secureframe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var DefaultRESTEndpoint = "https://api.secureframe.com"
+
+// RESTClient is a client for the documented Secureframe public REST API.
+// See https://developer.secureframe.com/ for details.
+type RESTClient struct {
+	// Endpoint is the base URL of the REST API
+	Endpoint string
+	// HTTPClient is the client used to make requests
+	HTTPClient *http.Client
+	// UserAgent is sent with every request
+	UserAgent string
+	// Token is a long-lived "<API KEY> <SECRET KEY>" pair
+	Token string
+	// Retry controls how failed requests are retried
+	Retry RetryPolicy
+	// Limiter throttles every request made by the client, and may be shared with other clients
+	Limiter *Limiter
+	// Concurrency is the number of requests for per-test controls and assertion results made in parallel
+	Concurrency int
+	// Filter, if set, selects which tests are returned. The REST API does not return tags or owners.
+	Filter *Filter
+	// Excluded, if set, records the tests skipped by Filter
+	Excluded *Exclusions
+}
+
+// NewRESTClient returns a client for the default Secureframe REST endpoint
+func NewRESTClient(token string) *RESTClient {
+	return &RESTClient{
+		Endpoint:    DefaultRESTEndpoint,
+		HTTPClient:  http.DefaultClient,
+		UserAgent:   DefaultUserAgent,
+		Token:       token,
+		Retry:       DefaultRetryPolicy,
+		Limiter:     NewLimiter(DefaultRequestsPerSecond, 1),
+		Concurrency: DefaultConcurrency,
+	}
+}
+
+// maxRESTRequests is the number of requests a single listing may make, and the number of extra pages that
+// per-test requests may make between them, as secondary protection against accidentally DoS'ing Secureframe
+const maxRESTRequests = 50
+
+// budget is a number of requests shared between every request made for an operation
+type budget struct {
+	left int64
+}
+
+// newBudget returns a budget of n requests
+func newBudget(n int) *budget {
+	return &budget{left: int64(n)}
+}
+
+// take spends a request from the budget, returning false if none are left
+func (b *budget) take() bool {
+	return atomic.AddInt64(&b.left, -1) >= 0
+}
+
+// restResource is a JSON:API style resource, as returned by the REST API
+type restResource struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+type restLinks struct {
+	Next string `json:"next"`
+}
+
+type restResponse struct {
+	Data  []restResource `json:"data"`
+	Links restLinks      `json:"links"`
+}
+
+type restTest struct {
+	Key                           string        `json:"key"`
+	Title                         string        `json:"title"`
+	Description                   string        `json:"description"`
+	Pass                          bool          `json:"pass"`
+	Enabled                       bool          `json:"enabled"`
+	Optional                      bool          `json:"optional"`
+	DisabledJustification         string        `json:"disabled_justification"`
+	PassedWithUploadJustification string        `json:"passed_with_upload_justification"`
+	AssertionKey                  string        `json:"assertion_key"`
+	AssertionData                 AssertionData `json:"assertion_data"`
+	ConditionKey                  string        `json:"condition_key"`
+	TestDomain                    string        `json:"test_domain"`
+	TestFunction                  string        `json:"test_function"`
+	TestType                      string        `json:"test_type"`
+	ResourceCategory              string        `json:"resource_category"`
+	RecommendedAction             string        `json:"recommended_action"`
+	DetailedRemediationSteps      string        `json:"detailed_remediation_steps"`
+	Status                        string        `json:"status"`
+}
+
+type restControl struct {
+	Key         string      `json:"key"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Frameworks  []Framework `json:"frameworks"`
+}
+
+type restAssertionResult struct {
+	AssertionKey          string        `json:"assertion_key"`
+	CreatedAt             string        `json:"created_at"`
+	Data                  AssertionData `json:"data"`
+	DisabledJustification string        `json:"disabled_justification"`
+	Enabled               bool          `json:"enabled"`
+	Pass                  bool          `json:"pass"`
+	Optional              bool          `json:"optional"`
+	FailMessage           string        `json:"fail_message"`
+	ResourceableType      string        `json:"resourceable_type"`
+	ResourceableID        string        `json:"resourceable_id"`
+	ResourceableName      string        `json:"resourceable_name"`
+}
+
+// get fetches every page of a REST collection, starting at path, spending a request from b for each page
+func (c *RESTClient) get(ctx context.Context, path string, params url.Values, b *budget) ([]restResource, error) {
+	apiKey, _, _ := strings.Cut(c.Token, " ")
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	next := fmt.Sprintf("%s%s?%s", strings.TrimRight(c.Endpoint, "/"), path, params.Encode())
+	found := []restResource{}
+
+	for next != "" {
+		if !b.take() {
+			return found, ErrTooManyRequests
+		}
+
+		log.Printf("GET %s with %q token", next, apiKey)
+		resp, err := c.Retry.do(ctx, hc, func() (*http.Request, error) {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+
+			req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", c.Token)
+			req.Header.Set("Accept", "application/json")
+			if c.UserAgent != "" {
+				req.Header.Set("User-Agent", c.UserAgent)
+			}
+			return req, nil
+		})
+		if err != nil {
+			return found, err
+		}
+
+		rb, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return found, fmt.Errorf("read: %w", err)
+		}
+
+		if resp.StatusCode != 200 {
+			return found, &StatusError{StatusCode: resp.StatusCode}
+		}
+
+		out := &restResponse{}
+		if err := json.Unmarshal(rb, out); err != nil {
+			return found, &SchemaError{Err: err, Body: rb}
+		}
+
+		found = append(found, out.Data...)
+		next = out.Links.Next
+	}
+
+	return found, nil
+}
+
+// controls returns the controls a test maps to
+func (c *RESTClient) controls(ctx context.Context, id string, b *budget) ([]Control, []ControlV2, error) {
+	rs, err := c.get(ctx, fmt.Sprintf("/tests/%s/controls", url.PathEscape(id)), url.Values{"per_page": {"100"}}, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	controls := []Control{}
+	v2s := []ControlV2{}
+	for _, r := range rs {
+		rc := restControl{}
+		if err := json.Unmarshal(r.Attributes, &rc); err != nil {
+			return nil, nil, fmt.Errorf("control %s: %w", r.ID, &SchemaError{Err: err, Body: r.Attributes})
+		}
+
+		v2s = append(v2s, ControlV2{ID: r.ID, Frameworks: rc.Frameworks})
+		for _, f := range rc.Frameworks {
+			controls = append(controls, Control{
+				ID:          r.ID,
+				Key:         rc.Key,
+				Name:        rc.Name,
+				Description: rc.Description,
+				Report:      report{Key: f.Key, Label: f.Label},
+			})
+		}
+	}
+	return controls, v2s, nil
+}
+
+// assertionResults returns the failing assertion results for a test
+func (c *RESTClient) assertionResults(ctx context.Context, id string, b *budget) (AssertionResults, error) {
+	rs, err := c.get(ctx, fmt.Sprintf("/tests/%s/assertion_results", url.PathEscape(id)), url.Values{"pass": {"false"}, "per_page": {"100"}}, b)
+	if err != nil {
+		return AssertionResults{}, err
+	}
+
+	ars := AssertionResults{}
+	for _, r := range rs {
+		ra := restAssertionResult{}
+		if err := json.Unmarshal(r.Attributes, &ra); err != nil {
+			return ars, fmt.Errorf("assertion result %s: %w", r.ID, &SchemaError{Err: err, Body: r.Attributes})
+		}
+
+		ar := AssertionResult{
+			AssertionKey:          ra.AssertionKey,
+			CreatedAt:             ra.CreatedAt,
+			Data:                  ra.Data,
+			DisabledJustification: ra.DisabledJustification,
+			Enabled:               ra.Enabled,
+			Pass:                  ra.Pass,
+			Optional:              ra.Optional,
+			FailMessage:           ra.FailMessage,
+		}
+		if ra.ResourceableID != "" {
+			ar.Resourceable = &Resourceable{ID: ra.ResourceableID, Name: ra.ResourceableName}
+		}
+		ars.Collection = append(ars.Collection, ar)
+	}
+	return ars, nil
+}
+
+// ListTests returns all tests for the given report keys, without the details of failing tests
+func (c *RESTClient) ListTests(ctx context.Context, reportKeys []string) ([]Test, error) {
+	log.Printf("Listing Secureframe tests for %s via REST ...", reportKeys)
+	rs, err := c.get(ctx, "/tests", url.Values{"per_page": {strconv.Itoa(100)}}, newBudget(maxRESTRequests))
+	if err != nil {
+		return nil, fmt.Errorf("get tests: %w", err)
+	}
+
+	listed := []Test{}
+	for _, r := range rs {
+		rt := restTest{}
+		if err := json.Unmarshal(r.Attributes, &rt); err != nil {
+			return nil, fmt.Errorf("test %s: %w", r.ID, &SchemaError{Err: err, Body: r.Attributes})
+		}
+
+		t := Test{
+			ID:                            r.ID,
+			Key:                           rt.Key,
+			Description:                   rt.Description,
+			Enabled:                       rt.Enabled,
+			Pass:                          rt.Pass,
+			DisabledJustification:         rt.DisabledJustification,
+			PassedWithUploadJustification: rt.PassedWithUploadJustification,
+			Optional:                      rt.Optional,
+			Title:                         rt.Title,
+			V2: TestV2{
+				ID:                       r.ID,
+				Key:                      rt.Key,
+				Title:                    rt.Title,
+				Description:              rt.Description,
+				AssertionKey:             rt.AssertionKey,
+				AssertionData:            rt.AssertionData,
+				ConditionKey:             rt.ConditionKey,
+				TestDomain:               rt.TestDomain,
+				TestFunction:             rt.TestFunction,
+				TestType:                 rt.TestType,
+				ResourceCategory:         rt.ResourceCategory,
+				DetailedRemediationSteps: rt.DetailedRemediationSteps,
+				RecommendedAction:        rt.RecommendedAction,
+				Status:                   rt.Status,
+			},
+		}
+
+		// Checked before fetching controls, to avoid requests for unwanted tests
+		if !c.Filter.Match(t) {
+			c.Excluded.Add(t.ID, "test is excluded by the include/exclude patterns")
+			continue
+		}
+		listed = append(listed, t)
+	}
+
+	// Controls are needed to know which report a test applies to. The API has no bulk endpoint for them,
+	// so they are fetched per test, in parallel.
+	b := newBudget(len(listed) + maxRESTRequests)
+	err = forEach(ctx, len(listed), c.Concurrency, func(ctx context.Context, x int) error {
+		t := &listed[x]
+		var err error
+		t.V2.Controls, t.V2.ControlV2s, err = c.controls(ctx, t.ID, b)
+		if err != nil {
+			return fmt.Errorf("get controls (%s): %w", t.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found := []Test{}
+	for _, t := range listed {
+		if inReports(t, reportKeys) {
+			found = append(found, t)
+		}
+	}
+	return found, nil
+}
+
+// GetTests returns all tests for the given report keys, with details filled in for failing tests
+func (c *RESTClient) GetTests(ctx context.Context, reportKeys []string) ([]Test, error) {
+	found, err := c.ListTests(ctx, reportKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("got data on %d tests ... filling in", len(found))
+	failing := []int{}
+	for x, t := range found {
+		// No need for details in these cases
+		if t.Pass || !t.Enabled {
+			continue
+		}
+		failing = append(failing, x)
+	}
+
+	b := newBudget(len(failing) + maxRESTRequests)
+	err = forEach(ctx, len(failing), c.Concurrency, func(ctx context.Context, n int) error {
+		t := &found[failing[n]]
+		log.Printf("[%d/%d] Fetching assertion results for failing test %s", n+1, len(failing), t.ID)
+		ars, err := c.assertionResults(ctx, t.ID, b)
+		if err != nil {
+			return fmt.Errorf("get assertion results (%s): %w", t.ID, err)
+		}
+		t.AssertionResults = ars
+		t.TotalFailingAssertions = len(ars.Collection)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
@@ -0,0 +1,145 @@
+package secureframe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling on each retry after
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts. Retry-After hints are honoured in full, as retrying sooner only
+	// wastes attempts while still rate limited.
+	MaxDelay time.Duration
+	// MaxRetryAfter is the longest Retry-After hint that is waited for. Longer hints give up immediately.
+	MaxRetryAfter time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   5,
+	BaseDelay:     time.Second,
+	MaxDelay:      30 * time.Second,
+	MaxRetryAfter: 5 * time.Minute,
+}
+
+// do sends the request returned by newReq until it succeeds or the policy gives up.
+// newReq is called once per attempt, so that request bodies may be rebuilt.
+func (p RetryPolicy) do(ctx context.Context, hc *http.Client, newReq func() (*http.Request, error)) (*http.Response, error) {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, fmt.Errorf("request: %w", err)
+		}
+
+		resp, err := hc.Do(req)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		if err != nil && (!retryableErr(err) || attempt >= p.MaxAttempts) {
+			return nil, fmt.Errorf("do: %w", err)
+		}
+
+		if err == nil {
+			// Drain so that the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if attempt >= p.MaxAttempts {
+				return nil, &StatusError{StatusCode: resp.StatusCode, Attempts: attempt}
+			}
+			if d, ok := retryAfter(resp); ok && p.MaxRetryAfter > 0 && d > p.MaxRetryAfter {
+				return nil, fmt.Errorf("asked to retry after %s, which is longer than %s: %w", d.Round(time.Second), p.MaxRetryAfter, &StatusError{StatusCode: resp.StatusCode, Attempts: attempt})
+			}
+		}
+
+		wait := p.backoff(attempt, resp)
+		if err != nil {
+			log.Printf("%s %s attempt %d/%d failed: %v (retrying in %s)", req.Method, req.URL, attempt, p.MaxAttempts, err, wait)
+		} else {
+			log.Printf("%s %s attempt %d/%d failed: unexpected status code: %d (retrying in %s)", req.Method, req.URL, attempt, p.MaxAttempts, resp.StatusCode, wait)
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, fmt.Errorf("sleep: %w", err)
+		}
+	}
+}
+
+// retryable returns true if a response status code is worth retrying
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryableErr returns true if an error from http.Client.Do is worth retrying
+func retryableErr(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoff returns how long to wait before the next attempt, where attempt is 1 for the first retry
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		return d
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	// Equal jitter: keep at least half of the delay, but spread retries out so that concurrent callers don't retry in lockstep
+	if d > 0 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+// retryAfter parses the Retry-After header, which may be in seconds or an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d, returning early if the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,325 @@
+package secureframe
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// expectedShapes is the response shape of each GraphQL operation we depend on, keyed by operation name.
+// Types ending in "?" may be null or absent, and "any" matches any value without inspecting it.
+//
+//go:embed expected_shape.json
+var expectedShapes []byte
+
+// Shape maps the path of every field within a JSON document to its type, such as
+// "data.getCompanyTest.testV2.key": "string". Array elements are addressed as "[]".
+type Shape map[string]string
+
+const (
+	typeAny  = "any"
+	typeNull = "null"
+)
+
+// ExpectedShapes returns the checked-in response shape for each GraphQL operation
+func ExpectedShapes() (map[string]Shape, error) {
+	shapes := map[string]Shape{}
+	if err := json.Unmarshal(expectedShapes, &shapes); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return shapes, nil
+}
+
+// ShapeOf returns the shape of a JSON document
+func ShapeOf(raw []byte) (Shape, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	s := Shape{}
+	s.add("", v)
+	return s, nil
+}
+
+func (s Shape) add(path string, v interface{}) {
+	t := typeNull
+	switch o := v.(type) {
+	case map[string]interface{}:
+		t = "object"
+		for k, cv := range o {
+			if path == "" {
+				s.add(k, cv)
+				continue
+			}
+			s.add(path+"."+k, cv)
+		}
+	case []interface{}:
+		t = "array"
+		for _, cv := range o {
+			s.add(path+"[]", cv)
+		}
+	case string:
+		t = "string"
+	case json.Number:
+		t = "number"
+	case bool:
+		t = "boolean"
+	}
+
+	if path == "" {
+		return
+	}
+
+	// Array elements may disagree: a non-null type is more interesting than a null
+	if prev, ok := s[path]; !ok || prev == typeNull {
+		s[path] = t
+	}
+}
+
+// FieldChange is a field whose type differs from what was expected
+type FieldChange struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// Drift describes how a shape differs from what was expected
+type Drift struct {
+	// Unknown fields were returned, but are not expected
+	Unknown []string `json:"unknown,omitempty"`
+	// Missing fields are expected, but were not returned
+	Missing []string `json:"missing,omitempty"`
+	// Changed fields were returned with an unexpected type
+	Changed []FieldChange `json:"changed,omitempty"`
+}
+
+// Empty returns true if there is no drift
+func (d Drift) Empty() bool {
+	return len(d.Unknown) == 0 && len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+func (d Drift) String() string {
+	lines := []string{}
+	for _, p := range d.Unknown {
+		lines = append(lines, fmt.Sprintf("unknown field: %s", p))
+	}
+	for _, p := range d.Missing {
+		lines = append(lines, fmt.Sprintf("missing field: %s", p))
+	}
+	for _, c := range d.Changed {
+		lines = append(lines, fmt.Sprintf("type changed: %s (expected %s, got %s)", c.Path, c.Expected, c.Actual))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parent returns the path of the object containing a field, or "" for top-level fields
+func parent(path string) string {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// underAny returns true if a path is nested within a field that may contain anything
+func underAny(expected Shape, path string) bool {
+	for p := parent(path); p != ""; p = parent(p) {
+		if strings.TrimSuffix(expected[strings.TrimSuffix(p, "[]")], "?") == typeAny {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareShape returns the drift of an actual shape from the expected shape.
+// Fields are only reported as missing if the object containing them was returned.
+func CompareShape(expected Shape, actual Shape) Drift {
+	d := Drift{}
+	for p, at := range actual {
+		et, ok := expected[p]
+		if !ok {
+			if !underAny(expected, p) {
+				d.Unknown = append(d.Unknown, p)
+			}
+			continue
+		}
+
+		et = strings.TrimSuffix(et, "?")
+		if et == typeAny || at == typeNull || et == at {
+			continue
+		}
+		d.Changed = append(d.Changed, FieldChange{Path: p, Expected: et, Actual: at})
+	}
+
+	for p, et := range expected {
+		// Empty arrays have no elements to inspect
+		if strings.HasSuffix(et, "?") || strings.HasSuffix(p, "[]") {
+			continue
+		}
+		if _, ok := actual[p]; ok {
+			continue
+		}
+
+		pp := parent(p)
+		_, parentExpected := expected[pp]
+		if pp != "" && parentExpected && actual[pp] != "object" {
+			continue
+		}
+		d.Missing = append(d.Missing, p)
+	}
+
+	sort.Strings(d.Unknown)
+	sort.Strings(d.Missing)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Path < d.Changed[j].Path })
+	return d
+}
+
+// SchemaReport is the result of checking a single GraphQL operation
+type SchemaReport struct {
+	Operation string `json:"operation"`
+	Drift     Drift  `json:"drift"`
+	// Errors are problems decoding the response into our types, or errors returned by the API
+	Errors []string `json:"errors,omitempty"`
+}
+
+// OK returns true if the operation looks as expected
+func (r SchemaReport) OK() bool {
+	return r.Drift.Empty() && len(r.Errors) == 0
+}
+
+// checkOperation runs a query, comparing the response to its expected shape and decoding it into out
+func (c *Client) checkOperation(ctx context.Context, in payload, expected Shape, out interface{}) (SchemaReport, error) {
+	r := SchemaReport{Operation: in.OperationName}
+
+	rb, err := c.queryRaw(ctx, in)
+	if err != nil {
+		return r, fmt.Errorf("query: %w", err)
+	}
+
+	actual, err := ShapeOf(rb)
+	if err != nil {
+		return r, fmt.Errorf("shape: %w", err)
+	}
+
+	// GraphQL errors are reported separately, rather than as unknown fields
+	for p := range actual {
+		if p == "errors" || strings.HasPrefix(p, "errors[]") {
+			delete(actual, p)
+		}
+	}
+
+	r.Drift = CompareShape(expected, actual)
+	if err := json.Unmarshal(rb, out); err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("decode: %v", err))
+	}
+	return r, nil
+}
+
+// CheckSchema runs the queries that syncing depends on, and reports how the responses differ from what is expected.
+// If expected is nil, the checked-in shapes are used.
+func (c *Client) CheckSchema(ctx context.Context, expected map[string]Shape) ([]SchemaReport, error) {
+	if expected == nil {
+		var err error
+		expected, err = ExpectedShapes()
+		if err != nil {
+			return nil, fmt.Errorf("expected shapes: %w", err)
+		}
+	}
+
+	reports := []SchemaReport{}
+
+	in := c.companyTestV2sPayload(1)
+	list := &getCompanyTestsResponse{}
+	r, err := c.checkOperation(ctx, in, expected[in.OperationName], list)
+	if err != nil {
+		return reports, fmt.Errorf("%s: %w", in.OperationName, err)
+	}
+	for _, e := range list.Errors {
+		r.Errors = append(r.Errors, e.Error())
+	}
+	reports = append(reports, r)
+
+	// Prefer a failing test, as it has assertion results to inspect
+	id := ""
+	for _, t := range list.Data.SearchCompanyTests.Data.Collection {
+		if id == "" || (!t.Pass && t.Enabled) {
+			id = t.ID
+		}
+		if !t.Pass && t.Enabled {
+			break
+		}
+	}
+	if id == "" {
+		log.Printf("no tests returned: unable to check getCompanyTest")
+		return reports, nil
+	}
+
+	in = c.companyTestPayload(id, 1)
+	detail := &getCompanyTestResponse{}
+	r, err = c.checkOperation(ctx, in, expected[in.OperationName], detail)
+	if err != nil {
+		return reports, fmt.Errorf("%s: %w", in.OperationName, err)
+	}
+	for _, e := range detail.Errors {
+		r.Errors = append(r.Errors, e.Error())
+	}
+	reports = append(reports, r)
+
+	// Syncs fetch details in aliased batches, so check that query too. A second test is used if there is one,
+	// otherwise the same test is requested twice, which is still a valid batch.
+	ids := []string{id, id}
+	for _, t := range list.Data.SearchCompanyTests.Data.Collection {
+		if t.ID != id {
+			ids[1] = t.ID
+			break
+		}
+	}
+
+	in = c.batchPayload(ids)
+	shape, ok := expected[in.OperationName]
+	if !ok {
+		shape = batchShape(expected["getCompanyTest"], len(ids))
+	}
+	batch := &batchResponse{}
+	r, err = c.checkOperation(ctx, in, shape, batch)
+	if err != nil {
+		return reports, fmt.Errorf("%s: %w", in.OperationName, err)
+	}
+	for _, e := range batch.Errors {
+		r.Errors = append(r.Errors, e.Error())
+	}
+	for n := range ids {
+		if raw, ok := batch.Data[alias(n)]; ok {
+			if err := json.Unmarshal(raw, &Test{}); err != nil {
+				r.Errors = append(r.Errors, fmt.Sprintf("decode %s: %v", alias(n), err))
+			}
+		}
+	}
+	reports = append(reports, r)
+
+	return reports, nil
+}
+
+// batchShape returns the expected shape of a batch of n tests, in which every alias has the shape of getCompanyTest
+func batchShape(detail Shape, n int) Shape {
+	prefix := "data.getCompanyTest"
+	s := Shape{}
+	for path, typ := range detail {
+		if path != prefix && !strings.HasPrefix(path, prefix+".") {
+			s[path] = typ
+			continue
+		}
+		for a := 0; a < n; a++ {
+			s["data."+alias(a)+strings.TrimPrefix(path, prefix)] = typ
+		}
+	}
+	return s
+}
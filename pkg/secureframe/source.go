@@ -0,0 +1,16 @@
+package secureframe
+
+import "context"
+
+// TestSource is a backend that Secureframe tests can be fetched from
+type TestSource interface {
+	// GetTests returns all tests for the given report keys, with details filled in for failing tests
+	GetTests(ctx context.Context, reportKeys []string) ([]Test, error)
+	// ListTests returns all tests for the given report keys, without the details of failing tests
+	ListTests(ctx context.Context, reportKeys []string) ([]Test, error)
+}
+
+var (
+	_ TestSource = &Client{}
+	_ TestSource = &RESTClient{}
+)
@@ -0,0 +1,130 @@
+package secureframe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// stateVersion is bumped whenever the state file format changes, invalidating older files
+const stateVersion = 1
+
+// DefaultFullRefreshInterval is how often every failing test is fetched, even if it appears unchanged
+var DefaultFullRefreshInterval = 24 * time.Hour
+
+// Fingerprint identifies a version of a test, so that unchanged tests need not be fetched again
+type Fingerprint struct {
+	UpdatedAt     Time `json:"updatedAt"`
+	LastEvaluated Time `json:"lastEvaluated"`
+	Pass          bool `json:"pass"`
+	Enabled       bool `json:"enabled"`
+}
+
+// FingerprintOf returns the fingerprint of a test, as found in the test listing
+func FingerprintOf(t Test) Fingerprint {
+	return Fingerprint{
+		UpdatedAt:     t.UpdatedAt,
+		LastEvaluated: t.LastEvaluated,
+		Pass:          t.Pass,
+		Enabled:       t.Enabled,
+	}
+}
+
+// Equal returns true if two fingerprints refer to the same version of a test
+func (f Fingerprint) Equal(o Fingerprint) bool {
+	return f.UpdatedAt.Equal(o.UpdatedAt.Time) && f.LastEvaluated.Equal(o.LastEvaluated.Time) && f.Pass == o.Pass && f.Enabled == o.Enabled
+}
+
+// StateEntry is what was known about a test after the previous run
+type StateEntry struct {
+	Fingerprint Fingerprint `json:"fingerprint"`
+	// Test holds the details of failing tests, so that they may be reused
+	Test *Test `json:"test,omitempty"`
+}
+
+// State is carried between runs to allow incremental syncs
+type State struct {
+	Version         int                   `json:"version"`
+	LastFullRefresh time.Time             `json:"lastFullRefresh"`
+	LastDiscovery   time.Time             `json:"lastDiscovery"`
+	Tests           map[string]StateEntry `json:"tests"`
+}
+
+// NewState returns an empty state, which forces a full refresh
+func NewState() *State {
+	return &State{Version: stateVersion, Tests: map[string]StateEntry{}}
+}
+
+// LoadState reads state from path. A missing or outdated file results in an empty state.
+func LoadState(path string) (*State, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	s := &State{}
+	if err := json.Unmarshal(bs, s); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	if s.Version != stateVersion {
+		return NewState(), nil
+	}
+	if s.Tests == nil {
+		s.Tests = map[string]StateEntry{}
+	}
+	return s, nil
+}
+
+// Save writes state to path
+func (s *State) Save(path string) error {
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return os.WriteFile(path, bs, 0o600)
+}
+
+// needsFullRefresh returns true if every test should be fetched, regardless of its fingerprint
+func (s *State) needsFullRefresh(interval time.Duration) bool {
+	return s == nil || s.LastFullRefresh.IsZero() || time.Since(s.LastFullRefresh) >= interval
+}
+
+// DiscoveryDue returns true if issues that lost their sync label have not been searched for within interval
+func (s *State) DiscoveryDue(interval time.Duration) bool {
+	return s == nil || s.LastDiscovery.IsZero() || time.Since(s.LastDiscovery) >= interval
+}
+
+// cached returns the details of a test from the previous run, if its fingerprint is unchanged
+func (s *State) cached(listing Test) (Test, bool) {
+	if s == nil {
+		return Test{}, false
+	}
+	e, ok := s.Tests[listing.ID]
+	if !ok || e.Test == nil || !e.Fingerprint.Equal(FingerprintOf(listing)) {
+		return Test{}, false
+	}
+	return *e.Test, true
+}
+
+// record replaces the state with the tests from this run. listing and detailed must be in the same order.
+func (s *State) record(listing []Test, detailed []Test, full bool) {
+	s.Tests = map[string]StateEntry{}
+	for x, t := range listing {
+		e := StateEntry{Fingerprint: FingerprintOf(t)}
+		if !t.Pass && t.Enabled {
+			d := detailed[x]
+			e.Test = &d
+		}
+		s.Tests[t.ID] = e
+	}
+	if full {
+		s.LastFullRefresh = time.Now()
+	}
+}
@@ -0,0 +1,45 @@
+package secureframe
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Time handles timestamps that the API returns as RFC3339 strings, bare dates, or null
+type Time struct {
+	time.Time
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if s == nil || *s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	for _, l := range timeLayouts {
+		if pt, err := time.Parse(l, *s); err == nil {
+			t.Time = pt
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to parse time: %q", *s)
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339Nano))
+}
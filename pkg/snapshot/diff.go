@@ -0,0 +1,214 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+)
+
+// TestRef identifies a test within a diff
+type TestRef struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+func refOf(t secureframe.Test) TestRef {
+	return TestRef{ID: t.ID, Key: t.V2.Key, Title: t.V2.Title}
+}
+
+func (r TestRef) String() string {
+	return fmt.Sprintf("%s: %s", r.Key, r.Title)
+}
+
+// ResourceChange lists the failing resources that were added or removed for a test that failed in both snapshots
+type ResourceChange struct {
+	Test    TestRef  `json:"test"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// TextChange is a change to the remediation text of a test that failed in both snapshots
+type TextChange struct {
+	Test  TestRef `json:"test"`
+	Field string  `json:"field"`
+	Old   string  `json:"old"`
+	New   string  `json:"new"`
+}
+
+// Diff describes how compliance state changed between two snapshots
+type Diff struct {
+	// From and To are when the older and newer snapshots were created
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Added          []TestRef        `json:"added,omitempty"`
+	Removed        []TestRef        `json:"removed,omitempty"`
+	StartedFailing []TestRef        `json:"startedFailing,omitempty"`
+	StartedPassing []TestRef        `json:"startedPassing,omitempty"`
+	Enabled        []TestRef        `json:"enabled,omitempty"`
+	Disabled       []TestRef        `json:"disabled,omitempty"`
+	Resources      []ResourceChange `json:"resources,omitempty"`
+	Remediation    []TextChange     `json:"remediation,omitempty"`
+}
+
+// Empty returns true if nothing changed
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.StartedFailing) == 0 && len(d.StartedPassing) == 0 &&
+		len(d.Enabled) == 0 && len(d.Disabled) == 0 && len(d.Resources) == 0 && len(d.Remediation) == 0
+}
+
+// failing returns true if a test is enabled and failing, and would therefore have an open issue
+func failing(t secureframe.Test) bool {
+	return t.Enabled && !t.Pass
+}
+
+// resources returns the IDs of the failing resources of a test
+func resources(t secureframe.Test) map[string]bool {
+	rs := map[string]bool{}
+	for _, a := range t.AssertionResults.Collection {
+		if a.Resourceable != nil {
+			rs[secureframe.ResourceID(*a.Resourceable)] = true
+		}
+	}
+	return rs
+}
+
+// missing returns the keys of a that are not in b, sorted
+func missing(a map[string]bool, b map[string]bool) []string {
+	out := []string{}
+	for k := range a {
+		if !b[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Compare returns the changes between an older and a newer snapshot
+func Compare(older *Snapshot, newer *Snapshot) Diff {
+	d := Diff{From: older.CreatedAt, To: newer.CreatedAt}
+
+	oldByID := map[string]secureframe.Test{}
+	for _, t := range older.Tests {
+		oldByID[t.ID] = t
+	}
+	newByID := map[string]secureframe.Test{}
+	for _, t := range newer.Tests {
+		newByID[t.ID] = t
+	}
+
+	for _, t := range older.Tests {
+		if _, ok := newByID[t.ID]; !ok {
+			d.Removed = append(d.Removed, refOf(t))
+		}
+	}
+
+	for _, nt := range newer.Tests {
+		ot, ok := oldByID[nt.ID]
+		if !ok {
+			d.Added = append(d.Added, refOf(nt))
+			continue
+		}
+		r := refOf(nt)
+
+		switch {
+		case ot.Enabled && !nt.Enabled:
+			d.Disabled = append(d.Disabled, r)
+		case !ot.Enabled && nt.Enabled:
+			d.Enabled = append(d.Enabled, r)
+		}
+
+		switch {
+		case !failing(ot) && failing(nt):
+			d.StartedFailing = append(d.StartedFailing, r)
+		case failing(ot) && !failing(nt) && nt.Pass:
+			d.StartedPassing = append(d.StartedPassing, r)
+		}
+
+		// Details such as failing resources and remediation text are only fetched for failing tests
+		if !failing(ot) || !failing(nt) {
+			continue
+		}
+
+		ors, nrs := resources(ot), resources(nt)
+		rc := ResourceChange{Test: r, Added: missing(nrs, ors), Removed: missing(ors, nrs)}
+		if len(rc.Added) > 0 || len(rc.Removed) > 0 {
+			d.Resources = append(d.Resources, rc)
+		}
+
+		if ot.V2.RecommendedAction != nt.V2.RecommendedAction {
+			d.Remediation = append(d.Remediation, TextChange{Test: r, Field: "recommendedAction", Old: ot.V2.RecommendedAction, New: nt.V2.RecommendedAction})
+		}
+		if ot.V2.DetailedRemediationSteps != nt.V2.DetailedRemediationSteps {
+			d.Remediation = append(d.Remediation, TextChange{Test: r, Field: "detailedRemediationSteps", Old: ot.V2.DetailedRemediationSteps, New: nt.V2.DetailedRemediationSteps})
+		}
+	}
+
+	for _, refs := range [][]TestRef{d.Added, d.Removed, d.StartedFailing, d.StartedPassing, d.Enabled, d.Disabled} {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Key < refs[j].Key })
+	}
+	sort.Slice(d.Resources, func(i, j int) bool { return d.Resources[i].Test.Key < d.Resources[j].Test.Key })
+	sort.SliceStable(d.Remediation, func(i, j int) bool { return d.Remediation[i].Test.Key < d.Remediation[j].Test.Key })
+	return d
+}
+
+// Markdown renders the diff for humans
+func (d Diff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Secureframe changes from %s to %s\n\n", d.From.Format(time.RFC3339), d.To.Format(time.RFC3339))
+
+	section := func(title string, refs []TestRef) {
+		if len(refs) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "## %s (%d)\n\n", title, len(refs))
+		for _, r := range refs {
+			fmt.Fprintf(&b, "* %s\n", r)
+		}
+		b.WriteString("\n")
+	}
+
+	section("Started failing", d.StartedFailing)
+	section("Started passing", d.StartedPassing)
+	section("Enabled", d.Enabled)
+	section("Disabled", d.Disabled)
+	section("Added", d.Added)
+	section("Removed", d.Removed)
+
+	if len(d.Resources) > 0 {
+		fmt.Fprintf(&b, "## Failing resources (%d tests)\n\n", len(d.Resources))
+		for _, rc := range d.Resources {
+			fmt.Fprintf(&b, "### %s\n\n", rc.Test)
+			for _, r := range rc.Added {
+				fmt.Fprintf(&b, "* now failing: %s\n", r)
+			}
+			for _, r := range rc.Removed {
+				fmt.Fprintf(&b, "* no longer failing: %s\n", r)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(d.Remediation) > 0 {
+		fmt.Fprintf(&b, "## Remediation changes (%d)\n\n", len(d.Remediation))
+		for _, tc := range d.Remediation {
+			// Detailed remediation steps are HTML, so are too long to show inline
+			if tc.Field == "recommendedAction" {
+				fmt.Fprintf(&b, "* %s: recommended action changed from %q to %q\n", tc.Test, tc.Old, tc.New)
+				continue
+			}
+			fmt.Fprintf(&b, "* %s: detailed remediation steps changed\n", tc.Test)
+		}
+		b.WriteString("\n")
+	}
+
+	if d.Empty() {
+		b.WriteString("No changes.\n")
+	}
+	return b.String()
+}
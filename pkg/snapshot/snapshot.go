@@ -0,0 +1,106 @@
+// Package snapshot reads and writes point-in-time exports of Secureframe tests
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+)
+
+// Version is bumped whenever the snapshot format changes incompatibly
+const Version = 1
+
+// Snapshot is the fully detailed state of Secureframe tests at a point in time
+type Snapshot struct {
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	CompanyID  string             `json:"companyId,omitempty"`
+	ReportKeys []string           `json:"reportKeys"`
+	Tests      []secureframe.Test `json:"tests"`
+}
+
+// New returns a snapshot of tests, which were fetched for the given report keys
+func New(companyID string, reportKeys []string, tests []secureframe.Test) *Snapshot {
+	return &Snapshot{
+		Version:    Version,
+		CreatedAt:  time.Now().UTC(),
+		CompanyID:  companyID,
+		ReportKeys: reportKeys,
+		Tests:      tests,
+	}
+}
+
+// Read reads a snapshot from path
+func Read(path string) (*Snapshot, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(bs, s); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+
+	if s.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported snapshot version %d (expected %d)", path, s.Version, Version)
+	}
+	return s, nil
+}
+
+// Write writes a snapshot to path as indented JSON
+func (s *Snapshot) Write(path string) error {
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return os.WriteFile(path, append(bs, '\n'), 0o600)
+}
+
+// FileSource serves tests from a snapshot, rather than from the Secureframe API
+type FileSource struct {
+	// Snapshot is the snapshot that tests are served from
+	Snapshot *Snapshot
+	// Filter, if set, selects which tests are returned
+	Filter *secureframe.Filter
+	// Excluded, if set, records the tests skipped by Filter
+	Excluded *secureframe.Exclusions
+}
+
+var _ secureframe.TestSource = &FileSource{}
+
+// NewFileSource returns a source for the snapshot at path
+func NewFileSource(path string) (*FileSource, error) {
+	s, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("loaded %d tests from snapshot %s, created at %s", len(s.Tests), path, s.CreatedAt)
+	return &FileSource{Snapshot: s}, nil
+}
+
+// GetTests returns the tests in the snapshot for the given report keys
+func (f *FileSource) GetTests(ctx context.Context, reportKeys []string) ([]secureframe.Test, error) {
+	found := []secureframe.Test{}
+	for _, t := range f.Snapshot.Tests {
+		if len(reportKeys) > 0 && len(t.Frameworks(reportKeys)) == 0 {
+			continue
+		}
+		if !f.Filter.Match(t) {
+			f.Excluded.Add(t.ID, "test is excluded by the include/exclude patterns")
+			continue
+		}
+		found = append(found, t)
+	}
+	return found, nil
+}
+
+// ListTests returns the tests in the snapshot for the given report keys. Details are included, as they are already known.
+func (f *FileSource) ListTests(ctx context.Context, reportKeys []string) ([]secureframe.Test, error) {
+	return f.GetTests(ctx, reportKeys)
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 2
+
+// lineDiff returns the lines that differ between two bodies, prefixed with "-" or "+" and surrounded by a little
+// unchanged context, or "" if they are the same. Bodies are short, so a simple longest common subsequence will do.
+func lineDiff(before string, after string) string {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{}
+	changed := []bool{}
+	add := func(prefix string, line string, change bool) {
+		lines = append(lines, prefix+line)
+		changed = append(changed, change)
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			add(" ", a[i], false)
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			add("-", a[i], true)
+			i++
+		default:
+			add("+", b[j], true)
+			j++
+		}
+	}
+
+	// Only show unchanged lines near a change
+	show := make([]bool, len(lines))
+	found := false
+	for n, c := range changed {
+		if !c {
+			continue
+		}
+		found = true
+		for k := n - diffContext; k <= n+diffContext; k++ {
+			if k >= 0 && k < len(lines) {
+				show[k] = true
+			}
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	for n, l := range lines {
+		if !show[n] {
+			if n > 0 && show[n-1] {
+				sb.WriteString("...\n")
+			}
+			continue
+		}
+		sb.WriteString(l + "\n")
+	}
+	return sb.String()
+}
+
+// splitLines splits a body into lines, ignoring carriage returns and a trailing newline
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultDelay is how long to pause after the first modification, growing with each one after it
+	DefaultDelay = 250 * time.Millisecond
+	// DefaultMaxDelay caps the pause between modifications
+	DefaultMaxDelay = 5 * time.Second
+)
+
+// Executor applies plans to a Tracker
+type Executor struct {
+	Tracker Tracker
+	// DryRun logs each action without applying it
+	DryRun bool
+	// Delay is the pause between modifications, multiplied by the number of modifications made so far,
+	// which avoids the secondary rate limits of the GitHub API
+	Delay time.Duration
+	// MaxDelay caps the pause between modifications
+	MaxDelay time.Duration
+}
+
+// NewExecutor returns an Executor with the default delays
+func NewExecutor(t Tracker) *Executor {
+	return &Executor{Tracker: t, Delay: DefaultDelay, MaxDelay: DefaultMaxDelay}
+}
+
+// Apply applies each action of a plan in order, stopping at the first that fails
+func (e *Executor) Apply(ctx context.Context, plan *Plan) error {
+	for n, a := range plan.Actions {
+		log.Printf("%s", a)
+		if e.DryRun {
+			continue
+		}
+
+		if n > 0 {
+			e.pause(n)
+		}
+		if err := e.apply(ctx, a); err != nil {
+			return fmt.Errorf("%s: %w", a, err)
+		}
+	}
+	return nil
+}
+
+// pause sleeps before the nth modification
+func (e *Executor) pause(n int) {
+	d := time.Duration(n) * e.Delay
+	if e.MaxDelay > 0 && d > e.MaxDelay {
+		d = e.MaxDelay
+	}
+	time.Sleep(d)
+}
+
+// apply applies a single action
+func (e *Executor) apply(ctx context.Context, a Action) error {
+	switch a.Type {
+	case ActionCreate:
+		if a.Form == nil {
+			return fmt.Errorf("no issue form")
+		}
+		return e.Tracker.Create(ctx, *a.Form)
+	case ActionUpdate, ActionReopen:
+		if a.Issue == nil || a.Form == nil {
+			return fmt.Errorf("no issue or issue form")
+		}
+		return e.Tracker.Update(ctx, a.Issue, *a.Form)
+	case ActionClose:
+		if a.Issue == nil {
+			return fmt.Errorf("no issue")
+		}
+		return e.Tracker.Close(ctx, a.Issue, a.Label)
+	case ActionCloseDuplicate:
+		if a.Issue == nil || a.Canonical == nil {
+			return fmt.Errorf("no issue or canonical issue")
+		}
+		return e.Tracker.CloseDuplicate(ctx, a.Canonical, a.Issue)
+	case ActionRelabel:
+		if a.Issue == nil {
+			return fmt.Errorf("no issue")
+		}
+		return e.Tracker.Relabel(ctx, a.Issue)
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+}
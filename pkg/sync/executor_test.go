@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
+	"github.com/google/go-github/v44/github"
+)
+
+// fakeTracker records the calls made to it, failing those listed in fail
+type fakeTracker struct {
+	calls []string
+	fail  map[string]bool
+}
+
+func (f *fakeTracker) record(call string) error {
+	f.calls = append(f.calls, call)
+	if f.fail[call] {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (f *fakeTracker) Create(ctx context.Context, ft issue.IssueForm) error {
+	return f.record("create " + ft.Title)
+}
+
+func (f *fakeTracker) Update(ctx context.Context, i *github.Issue, ft issue.IssueForm) error {
+	return f.record(fmt.Sprintf("update #%d", i.GetNumber()))
+}
+
+func (f *fakeTracker) Close(ctx context.Context, i *github.Issue, label string) error {
+	return f.record(fmt.Sprintf("close #%d %s", i.GetNumber(), label))
+}
+
+func (f *fakeTracker) CloseDuplicate(ctx context.Context, canonical *github.Issue, dup *github.Issue) error {
+	return f.record(fmt.Sprintf("close #%d as duplicate of #%d", dup.GetNumber(), canonical.GetNumber()))
+}
+
+func (f *fakeTracker) Relabel(ctx context.Context, i *github.Issue) error {
+	return f.record(fmt.Sprintf("relabel #%d", i.GetNumber()))
+}
+
+func number(n int) *github.Issue {
+	return &github.Issue{Number: github.Int(n)}
+}
+
+// every returns a plan with one of each action type
+func every() *Plan {
+	return &Plan{Actions: []Action{
+		{Type: ActionRelabel, Issue: number(1)},
+		{Type: ActionCloseDuplicate, Issue: number(2), Canonical: number(3)},
+		{Type: ActionCreate, Form: &issue.IssueForm{Title: "new"}},
+		{Type: ActionUpdate, Issue: number(4), Form: &issue.IssueForm{}},
+		{Type: ActionReopen, Issue: number(5), Form: &issue.IssueForm{}},
+		{Type: ActionClose, Issue: number(6), Label: issue.PassingLabel},
+	}}
+}
+
+func TestApply(t *testing.T) {
+	allCalls := []string{
+		"relabel #1",
+		"close #2 as duplicate of #3",
+		"create new",
+		"update #4",
+		"update #5",
+		"close #6 passing",
+	}
+
+	tests := []struct {
+		name    string
+		dryRun  bool
+		fail    map[string]bool
+		plan    *Plan
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "applies actions in order",
+			plan: every(),
+			want: allCalls,
+		},
+		{
+			name:    "stops at the first error",
+			fail:    map[string]bool{"create new": true},
+			plan:    every(),
+			want:    allCalls[:3],
+			wantErr: true,
+		},
+		{
+			name:   "dry run makes no calls",
+			dryRun: true,
+			plan:   every(),
+			want:   nil,
+		},
+		{
+			name:    "rejects incomplete actions",
+			plan:    &Plan{Actions: []Action{{Type: ActionUpdate, Issue: number(1)}, {Type: ActionCreate, Form: &issue.IssueForm{Title: "new"}}}},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "rejects unknown actions",
+			plan:    &Plan{Actions: []Action{{Type: "delete", Issue: number(1)}}},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeTracker{fail: tc.fail}
+			ex := &Executor{Tracker: f, DryRun: tc.dryRun}
+
+			err := ex.Apply(context.Background(), tc.plan)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Apply error = %v, want error: %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(f.calls, tc.want) {
+				t.Errorf("calls = %q, want %q", f.calls, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// actionTitles are the section headings of each action type, in the order they are shown
+var actionTitles = []struct {
+	Type  ActionType
+	Title string
+}{
+	{ActionCreate, "Create"},
+	{ActionUpdate, "Update"},
+	{ActionReopen, "Reopen"},
+	{ActionClose, "Close"},
+	{ActionCloseDuplicate, "Close as duplicate"},
+	{ActionRelabel, "Relabel"},
+}
+
+// Markdown renders a plan for human review
+func (p *Plan) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# secureframe-issue-sync plan for %s\n\n", p.Repo)
+	fmt.Fprintf(&b, "Planned at %s from %d existing issues.\n\n", p.CreatedAt.Format(time.RFC3339), len(p.Issues))
+
+	if len(p.Actions) == 0 {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+
+	for _, at := range actionTitles {
+		n := p.Count(at.Type)
+		if n == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s (%d)\n\n", at.Title, n)
+		for _, a := range p.Actions {
+			if a.Type != at.Type {
+				continue
+			}
+			writeAction(&b, a)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeAction renders a single action, with its body diff collapsed as it may be long
+func writeAction(b *strings.Builder, a Action) {
+	switch {
+	case a.Issue != nil:
+		fmt.Fprintf(b, "* #%d %s: %s", a.Issue.GetNumber(), a.Issue.GetTitle(), a.Reason)
+	case a.Form != nil:
+		fmt.Fprintf(b, "* %s: %s", a.Form.Title, a.Reason)
+	default:
+		fmt.Fprintf(b, "* test %s: %s", a.TestID, a.Reason)
+	}
+	if a.Label != "" {
+		fmt.Fprintf(b, " (labelled %q)", a.Label)
+	}
+	b.WriteString("\n")
+
+	if a.Issue != nil && a.Form != nil && a.Issue.GetTitle() != a.Form.Title {
+		fmt.Fprintf(b, "  * title changes to: %s\n", a.Form.Title)
+	}
+	if a.Diff == "" {
+		return
+	}
+
+	// Issue bodies may contain code blocks of their own
+	fence := "```"
+	for strings.Contains(a.Diff, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "\n<details><summary>Body diff</summary>\n\n%sdiff\n%s%s\n\n</details>\n", fence, a.Diff, fence)
+}
@@ -0,0 +1,337 @@
+// Package sync reconciles Secureframe tests with issues: a Planner decides what should change, and an Executor
+// applies those changes to a Tracker, such as GitHub.
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+	"github.com/google/go-github/v44/github"
+)
+
+// ActionType is the kind of change an Action makes
+type ActionType string
+
+const (
+	// ActionCreate opens an issue for a failing test
+	ActionCreate ActionType = "create"
+	// ActionUpdate rewrites an open issue whose content is out of date
+	ActionUpdate ActionType = "update"
+	// ActionReopen reopens a closed issue for a test that is failing again
+	ActionReopen ActionType = "reopen"
+	// ActionClose closes an issue for a test that is passing, disabled, excluded or no longer tracked
+	ActionClose ActionType = "close"
+	// ActionCloseDuplicate closes an extra issue for a test, in favour of its canonical issue
+	ActionCloseDuplicate ActionType = "close-duplicate"
+	// ActionRelabel restores the sync label to a managed issue that lost it
+	ActionRelabel ActionType = "relabel"
+)
+
+// Action is a single change to make to an issue
+type Action struct {
+	Type   ActionType `json:"type"`
+	TestID string     `json:"testId"`
+	// Reason explains why the action is needed, for humans
+	Reason string `json:"reason"`
+	// Issue is the existing issue to change, which is nil for ActionCreate
+	Issue *github.Issue `json:"issue,omitempty"`
+	// Form is the rendered issue, for ActionCreate, ActionUpdate and ActionReopen
+	Form *issue.IssueForm `json:"form,omitempty"`
+	// Label is the label that ActionClose adds to explain why the issue was closed
+	Label string `json:"label,omitempty"`
+	// Canonical is the issue that ActionCloseDuplicate keeps
+	Canonical *github.Issue `json:"canonical,omitempty"`
+	// Diff shows how the body of the issue changes, for ActionCreate, ActionUpdate and ActionReopen
+	Diff string `json:"diff,omitempty"`
+}
+
+func (a Action) String() string {
+	switch {
+	case a.Issue != nil:
+		return fmt.Sprintf("%s #%d (%s): %s", a.Type, a.Issue.GetNumber(), a.Issue.GetTitle(), a.Reason)
+	case a.Form != nil:
+		return fmt.Sprintf("%s %q: %s", a.Type, a.Form.Title, a.Reason)
+	default:
+		return fmt.Sprintf("%s test %s: %s", a.Type, a.TestID, a.Reason)
+	}
+}
+
+// IssueVersion identifies the version of an issue that a plan was made from
+type IssueVersion struct {
+	Number    int       `json:"number"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PlanVersion is bumped whenever the format of saved plans changes
+const PlanVersion = 1
+
+// Plan is the list of actions that reconciles issues with tests, in the order they should be applied
+type Plan struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Repo is the GitHub repository the plan applies to, as org/project
+	Repo string `json:"repo,omitempty"`
+	// Labels are the labels the plan relies on, which must exist before it is applied
+	Labels []string `json:"labels,omitempty"`
+	// Issues are the versions of every issue that the plan was made from
+	Issues  []IssueVersion `json:"issues"`
+	Actions []Action       `json:"actions"`
+}
+
+// ReadPlan reads a plan saved by Write
+func ReadPlan(path string) (*Plan, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	p := &Plan{}
+	if err := json.Unmarshal(bs, p); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+
+	if p.Version != PlanVersion {
+		return nil, fmt.Errorf("%s: unsupported plan version %d (expected %d)", path, p.Version, PlanVersion)
+	}
+	return p, nil
+}
+
+// Write writes a plan to path as indented JSON
+func (p *Plan) Write(path string) error {
+	bs, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return os.WriteFile(path, append(bs, '\n'), 0o600)
+}
+
+// Record notes the versions of the issues a plan was made from, so that later changes to them can be detected
+func (p *Plan) Record(issues []*github.Issue) {
+	p.Issues = []IssueVersion{}
+	for _, i := range issues {
+		p.Issues = append(p.Issues, IssueVersion{Number: i.GetNumber(), UpdatedAt: i.GetUpdatedAt()})
+	}
+	sort.Slice(p.Issues, func(a, b int) bool { return p.Issues[a].Number < p.Issues[b].Number })
+}
+
+// Changed describes how the current issues differ from those the plan was made from: issues that were updated or
+// deleted since, and synced issues that did not exist. A plan is only safe to apply if nothing has changed.
+func (p *Plan) Changed(current []*github.Issue) []string {
+	byNumber := map[int]*github.Issue{}
+	for _, i := range current {
+		byNumber[i.GetNumber()] = i
+	}
+
+	changes := []string{}
+	planned := map[int]bool{}
+	for _, v := range p.Issues {
+		planned[v.Number] = true
+		i, ok := byNumber[v.Number]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("#%d no longer exists", v.Number))
+		case !i.GetUpdatedAt().Equal(v.UpdatedAt):
+			changes = append(changes, fmt.Sprintf("#%d (%s) was updated at %s", v.Number, i.GetTitle(), i.GetUpdatedAt().Format(time.RFC3339)))
+		}
+	}
+	for _, i := range current {
+		if !planned[i.GetNumber()] {
+			changes = append(changes, fmt.Sprintf("#%d (%s) is new", i.GetNumber(), i.GetTitle()))
+		}
+	}
+	return changes
+}
+
+// Count returns the number of actions of a type
+func (p *Plan) Count(t ActionType) int {
+	n := 0
+	for _, a := range p.Actions {
+		if a.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+// Relabel returns the action that restores the sync label to a discovered issue
+func Relabel(d issue.Discovered) Action {
+	return Action{
+		Type:   ActionRelabel,
+		TestID: d.TestID,
+		Reason: fmt.Sprintf("issue is missing the %q label, but was found by its %s", issue.SyncLabel, d.How),
+		Issue:  d.Issue,
+	}
+}
+
+// Planner decides which actions reconcile issues with tests
+type Planner struct {
+	// AdditionalLabel is added to every issue, if set
+	AdditionalLabel string
+	// ReportKeys are the framework report keys being synced
+	ReportKeys []string
+	// Workspace is the name of the Secureframe workspace being synced, if any
+	Workspace string
+	// PreferActive chooses the duplicate issue with the most comments as canonical, rather than the oldest
+	PreferActive bool
+	// Excluded lists tests that still exist but were skipped by filters. Their issues are left alone, rather
+	// than closed as no longer tracked, so that changing a filter does not close issues en masse.
+	Excluded *secureframe.Exclusions
+	// CloseExcluded closes the open issues of excluded tests with ExcludedLabel, instead of leaving them alone
+	CloseExcluded bool
+}
+
+// ByTestID groups issues by the test they were rendered for. ids overrides the test ID of issues by number,
+// for issues that were recognized in some other way. Issues previously closed as duplicates are skipped.
+func ByTestID(issues []*github.Issue, ids map[int]string) map[string][]*github.Issue {
+	byID := map[string][]*github.Issue{}
+	for _, i := range issues {
+		if issue.IsClosedDuplicate(i) {
+			continue
+		}
+		id, ok := issue.TestID(i.GetBody())
+		if override, found := ids[i.GetNumber()]; found {
+			id, ok = override, true
+		}
+		if !ok {
+			log.Printf("no test ID found in issue #%d: %s", i.GetNumber(), i.GetTitle())
+			continue
+		}
+		byID[id] = append(byID[id], i)
+	}
+	return byID
+}
+
+// Plan returns the actions that reconcile issues, grouped by test ID, with tests
+func (p *Planner) Plan(tests []secureframe.Test, issues map[string][]*github.Issue) (*Plan, error) {
+	plan := &Plan{Version: PlanVersion, CreatedAt: time.Now(), Issues: []IssueVersion{}, Actions: []Action{}}
+
+	// Duplicates are consolidated first, so that only the canonical issue for each test is synced
+	ids := []string{}
+	for id := range issues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	canonical := map[string]*github.Issue{}
+	for _, id := range ids {
+		c, dups := issue.Canonical(issues[id], p.PreferActive)
+		canonical[id] = c
+		for _, d := range dups {
+			// Closed duplicates will not be reopened, as only the canonical issue is synced
+			if d.GetState() != "open" {
+				continue
+			}
+			plan.Actions = append(plan.Actions, Action{
+				Type:      ActionCloseDuplicate,
+				TestID:    id,
+				Reason:    fmt.Sprintf("duplicate of #%d", c.GetNumber()),
+				Issue:     d,
+				Canonical: c,
+			})
+		}
+	}
+
+	tracked := map[string]bool{}
+	for _, t := range tests {
+		tracked[t.ID] = true
+
+		a, err := p.planTest(t, canonical[t.ID])
+		if err != nil {
+			return nil, fmt.Errorf("test %s: %w", t.ID, err)
+		}
+		if a != nil {
+			plan.Actions = append(plan.Actions, *a)
+		}
+	}
+
+	// Close issues that are no longer being tracked by Secureframe, or, if asked to, whose tests are excluded
+	for _, id := range ids {
+		i := canonical[id]
+		if tracked[id] || i.GetState() == "closed" {
+			continue
+		}
+		if reason, ok := p.Excluded.Reason(id); ok {
+			if !p.CloseExcluded {
+				continue
+			}
+			plan.Actions = append(plan.Actions, Action{
+				Type:   ActionClose,
+				TestID: id,
+				Reason: reason,
+				Issue:  i,
+				Label:  issue.ExcludedLabel,
+			})
+			continue
+		}
+		plan.Actions = append(plan.Actions, Action{
+			Type:   ActionClose,
+			TestID: id,
+			Reason: "test is no longer tracked by Secureframe",
+			Issue:  i,
+			Label:  issue.DisabledLabel,
+		})
+	}
+
+	return plan, nil
+}
+
+// planTest returns the action needed for a single test and its issue, which may be nil, or nil if nothing needs to change
+func (p *Planner) planTest(t secureframe.Test, i *github.Issue) (*Action, error) {
+	failing := !t.Pass && t.Enabled
+
+	// Test does not exist in Github
+	if i == nil {
+		if !failing {
+			return nil, nil
+		}
+		ft, err := issue.FromTest(t, p.AdditionalLabel, p.ReportKeys, p.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return &Action{Type: ActionCreate, TestID: t.ID, Reason: "test is failing", Form: &ft, Diff: lineDiff("", ft.Body)}, nil
+	}
+
+	if i.GetState() == "closed" {
+		if !failing {
+			return nil, nil
+		}
+		ft, err := issue.FromTest(t, p.AdditionalLabel, p.ReportKeys, p.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return &Action{Type: ActionReopen, TestID: t.ID, Reason: "test is failing again", Issue: i, Form: &ft, Diff: bodyDiff(i, ft)}, nil
+	}
+
+	// Close passing or disabled tests
+	if t.Pass {
+		return &Action{Type: ActionClose, TestID: t.ID, Reason: "test is passing", Issue: i, Label: issue.PassingLabel}, nil
+	}
+	if !t.Enabled {
+		return &Action{Type: ActionClose, TestID: t.ID, Reason: "test is disabled", Issue: i, Label: issue.DisabledLabel}, nil
+	}
+
+	// Update failing tests
+	ft, err := issue.FromTest(t, p.AdditionalLabel, p.ReportKeys, p.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if !issue.NeedsUpdate(i, ft) {
+		return nil, nil
+	}
+	reason := "issue is out of date"
+	if issue.HandEdited(i.GetBody()) {
+		reason = "generated section was edited by hand"
+	}
+	return &Action{Type: ActionUpdate, TestID: t.ID, Reason: reason, Issue: i, Form: &ft, Diff: bodyDiff(i, ft)}, nil
+}
+
+// bodyDiff returns how updating an issue changes its body
+func bodyDiff(i *github.Issue, ft issue.IssueForm) string {
+	return lineDiff(i.GetBody(), issue.MergeBody(i.GetBody(), ft.Body))
+}
@@ -0,0 +1,286 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+	"github.com/google/go-github/v44/github"
+)
+
+// failing, passing and disabled return tests in each state
+func failing(id string) secureframe.Test {
+	return secureframe.Test{ID: id, Enabled: true, V2: secureframe.TestV2{Key: id, Title: "Test " + id}}
+}
+
+func passing(id string) secureframe.Test {
+	t := failing(id)
+	t.Pass = true
+	return t
+}
+
+func disabled(id string) secureframe.Test {
+	t := failing(id)
+	t.Enabled = false
+	return t
+}
+
+// existing returns an issue as it would be rendered for a test now
+func existing(t *testing.T, number int, state string, test secureframe.Test) *github.Issue {
+	t.Helper()
+	ft, err := issue.FromTest(test, "", nil, "")
+	if err != nil {
+		t.Fatalf("FromTest(%s): %v", test.ID, err)
+	}
+
+	created := time.Date(2022, 1, 1, 0, 0, number, 0, time.UTC)
+	i := &github.Issue{
+		Number:    github.Int(number),
+		State:     github.String(state),
+		Title:     github.String(ft.Title),
+		Body:      github.String(ft.Body),
+		CreatedAt: &created,
+		UpdatedAt: &created,
+	}
+	for _, l := range ft.Labels {
+		i.Labels = append(i.Labels, &github.Label{Name: github.String(l)})
+	}
+	return i
+}
+
+// stale returns an issue whose title is out of date
+func stale(t *testing.T, number int, state string, test secureframe.Test) *github.Issue {
+	i := existing(t, number, state, test)
+	i.Title = github.String("old title")
+	return i
+}
+
+// wantAction is the part of an Action that tests compare
+type wantAction struct {
+	Type      ActionType
+	TestID    string
+	Issue     int
+	Label     string
+	Canonical int
+}
+
+func TestPlan(t *testing.T) {
+	excluded := secureframe.NewExclusions()
+	excluded.Add("filtered", "test is excluded by the include/exclude patterns")
+
+	tests := []struct {
+		name    string
+		planner Planner
+		tests   []secureframe.Test
+		issues  func(t *testing.T) []*github.Issue
+		want    []wantAction
+	}{
+		{
+			name:  "create for a failing test without an issue",
+			tests: []secureframe.Test{failing("a")},
+			want:  []wantAction{{Type: ActionCreate, TestID: "a"}},
+		},
+		{
+			name:  "nothing for a passing test without an issue",
+			tests: []secureframe.Test{passing("a")},
+		},
+		{
+			name:  "nothing for a disabled test without an issue",
+			tests: []secureframe.Test{disabled("a")},
+		},
+		{
+			name:  "nothing for an up to date issue",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a"))}
+			},
+		},
+		{
+			name:  "update an out of date issue",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{stale(t, 1, "open", failing("a"))}
+			},
+			want: []wantAction{{Type: ActionUpdate, TestID: "a", Issue: 1}},
+		},
+		{
+			name:  "reopen a closed issue for a failing test",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "closed", failing("a"))}
+			},
+			want: []wantAction{{Type: ActionReopen, TestID: "a", Issue: 1}},
+		},
+		{
+			name:  "nothing for a closed issue for a passing test",
+			tests: []secureframe.Test{passing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "closed", failing("a"))}
+			},
+		},
+		{
+			name:  "close an issue for a passing test",
+			tests: []secureframe.Test{passing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a"))}
+			},
+			want: []wantAction{{Type: ActionClose, TestID: "a", Issue: 1, Label: issue.PassingLabel}},
+		},
+		{
+			name:  "close an issue for a disabled test",
+			tests: []secureframe.Test{disabled("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a"))}
+			},
+			want: []wantAction{{Type: ActionClose, TestID: "a", Issue: 1, Label: issue.DisabledLabel}},
+		},
+		{
+			name:  "close an orphaned issue",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a")), existing(t, 2, "open", failing("gone"))}
+			},
+			want: []wantAction{{Type: ActionClose, TestID: "gone", Issue: 2, Label: issue.DisabledLabel}},
+		},
+		{
+			name:  "nothing for a closed orphaned issue",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a")), existing(t, 2, "closed", failing("gone"))}
+			},
+		},
+		{
+			name:    "leave an issue for an excluded test alone",
+			planner: Planner{Excluded: excluded},
+			tests:   []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a")), existing(t, 2, "open", failing("filtered"))}
+			},
+		},
+		{
+			name:    "close an issue for an excluded test if asked to",
+			planner: Planner{Excluded: excluded, CloseExcluded: true},
+			tests:   []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "open", failing("a")), existing(t, 2, "open", failing("filtered"))}
+			},
+			want: []wantAction{{Type: ActionClose, TestID: "filtered", Issue: 2, Label: issue.ExcludedLabel}},
+		},
+		{
+			name:  "close duplicates before syncing the oldest issue",
+			tests: []secureframe.Test{passing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 2, "open", failing("a")), existing(t, 1, "open", failing("a"))}
+			},
+			want: []wantAction{
+				{Type: ActionCloseDuplicate, TestID: "a", Issue: 2, Canonical: 1},
+				{Type: ActionClose, TestID: "a", Issue: 1, Label: issue.PassingLabel},
+			},
+		},
+		{
+			name:    "keep the most active duplicate if asked to",
+			planner: Planner{PreferActive: true},
+			tests:   []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				busy := existing(t, 2, "open", failing("a"))
+				busy.Comments = github.Int(3)
+				return []*github.Issue{existing(t, 1, "open", failing("a")), busy}
+			},
+			want: []wantAction{{Type: ActionCloseDuplicate, TestID: "a", Issue: 1, Canonical: 2}},
+		},
+		{
+			name:  "prefer an open duplicate over an older closed one",
+			tests: []secureframe.Test{failing("a")},
+			issues: func(t *testing.T) []*github.Issue {
+				return []*github.Issue{existing(t, 1, "closed", failing("a")), existing(t, 2, "open", failing("a"))}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := []*github.Issue{}
+			if tc.issues != nil {
+				issues = tc.issues(t)
+			}
+
+			plan, err := tc.planner.Plan(tc.tests, ByTestID(issues, nil))
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+
+			got := []wantAction{}
+			for _, a := range plan.Actions {
+				got = append(got, wantAction{
+					Type:      a.Type,
+					TestID:    a.TestID,
+					Issue:     a.Issue.GetNumber(),
+					Label:     a.Label,
+					Canonical: a.Canonical.GetNumber(),
+				})
+				if a.Reason == "" {
+					t.Errorf("%s has no reason", a)
+				}
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got actions %+v, want %+v", got, tc.want)
+			}
+			for x := range got {
+				if got[x] != tc.want[x] {
+					t.Errorf("action %d: got %+v, want %+v", x, got[x], tc.want[x])
+				}
+			}
+		})
+	}
+}
+
+func TestPlanDiff(t *testing.T) {
+	plan, err := (&Planner{}).Plan([]secureframe.Test{failing("a")}, nil)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Diff == "" {
+		t.Fatalf("expected a create with a body diff, got %+v", plan.Actions)
+	}
+}
+
+func TestByTestID(t *testing.T) {
+	a := existing(t, 1, "open", failing("a"))
+	unknown := &github.Issue{Number: github.Int(2), Body: github.String("no marker here")}
+	discovered := &github.Issue{Number: github.Int(3), Body: github.String("no marker here either")}
+	dup := existing(t, 4, "closed", failing("a"))
+	dup.Labels = append(dup.Labels, &github.Label{Name: github.String(issue.DuplicateLabel)})
+
+	got := ByTestID([]*github.Issue{a, unknown, discovered, dup}, map[int]string{3: "b"})
+	if len(got) != 2 || len(got["a"]) != 1 || len(got["b"]) != 1 {
+		t.Errorf("ByTestID = %v, want a single issue for each of a and b", got)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	i := &github.Issue{Number: github.Int(5)}
+	a := Relabel(issue.Discovered{Issue: i, TestID: "a", How: "title"})
+	if a.Type != ActionRelabel || a.TestID != "a" || a.Issue != i || a.Reason == "" {
+		t.Errorf("Relabel = %+v", a)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	a := existing(t, 1, "open", failing("a"))
+	b := existing(t, 2, "open", failing("b"))
+	plan := &Plan{}
+	plan.Record([]*github.Issue{a, b})
+
+	if got := plan.Changed([]*github.Issue{a, b}); len(got) != 0 {
+		t.Errorf("Changed with no changes = %v", got)
+	}
+
+	edited := *b
+	later := b.GetUpdatedAt().Add(time.Minute)
+	edited.UpdatedAt = &later
+	created := existing(t, 3, "open", failing("c"))
+	if got := plan.Changed([]*github.Issue{&edited, created}); len(got) != 3 {
+		t.Errorf("Changed = %v, want a deleted, an edited and a new issue", got)
+	}
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
+	"github.com/google/go-github/v44/github"
+)
+
+// Tracker is an issue tracker that an Executor applies plans to
+type Tracker interface {
+	// Create opens a new issue
+	Create(ctx context.Context, ft issue.IssueForm) error
+	// Update rewrites and reopens an existing issue
+	Update(ctx context.Context, i *github.Issue, ft issue.IssueForm) error
+	// Close closes an issue, adding label to explain why
+	Close(ctx context.Context, i *github.Issue, label string) error
+	// CloseDuplicate closes dup in favour of canonical
+	CloseDuplicate(ctx context.Context, canonical *github.Issue, dup *github.Issue) error
+	// Relabel restores the sync label to an issue
+	Relabel(ctx context.Context, i *github.Issue) error
+}
+
+// GitHub is a Tracker for the issues within a GitHub repository
+type GitHub struct {
+	Client  *github.Client
+	Org     string
+	Project string
+	// ManagedLabels are the labels added by syncs, which are not copied from duplicates to their canonical issue
+	ManagedLabels []string
+}
+
+func (g *GitHub) Create(ctx context.Context, ft issue.IssueForm) error {
+	return issue.Create(ctx, g.Client, g.Org, g.Project, ft)
+}
+
+func (g *GitHub) Update(ctx context.Context, i *github.Issue, ft issue.IssueForm) error {
+	return issue.Update(ctx, g.Client, g.Org, g.Project, i, ft)
+}
+
+func (g *GitHub) Close(ctx context.Context, i *github.Issue, label string) error {
+	return issue.Close(ctx, g.Client, g.Org, g.Project, i, label)
+}
+
+func (g *GitHub) CloseDuplicate(ctx context.Context, canonical *github.Issue, dup *github.Issue) error {
+	return issue.CloseDuplicate(ctx, g.Client, g.Org, g.Project, canonical, dup, g.ManagedLabels)
+}
+
+func (g *GitHub) Relabel(ctx context.Context, i *github.Issue) error {
+	return issue.Relabel(ctx, g.Client, g.Org, g.Project, i)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/issue"
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/sync"
+	"github.com/google/go-github/v44/github"
+)
+
+// runPlan writes the changes a sync would make to a plan file, and prints them as Markdown, returning the exit code
+func runPlan(ctx context.Context, hc *http.Client, args []string) int {
+	if len(args) != 1 {
+		log.Printf("usage: plan <plan.json> (flags must precede the path)")
+		return exitUsage
+	}
+	path := args[0]
+
+	gc, hasToken := newGitHubClient(ctx, hc)
+	if !hasToken {
+		log.Printf("github-token is required to plan against existing issues")
+		return exitUsage
+	}
+
+	plan, _, err := planSync(ctx, hc, gc, hasToken)
+	if err != nil {
+		log.Printf("plan: %v", err)
+		return exitCode(err)
+	}
+	if plan == nil {
+		log.Printf("no Secureframe tests found: nothing to plan")
+		return exitFailure
+	}
+
+	if err := plan.Write(path); err != nil {
+		log.Printf("write plan: %v", err)
+		return exitFailure
+	}
+	log.Printf("wrote %d actions to %s", len(plan.Actions), path)
+	fmt.Print(plan.Markdown())
+	return 0
+}
+
+// runApply applies a plan file written by plan, refusing if any issue has changed since it was planned, returning the exit code
+func runApply(ctx context.Context, hc *http.Client, args []string) int {
+	if len(args) != 1 {
+		log.Printf("usage: apply <plan.json> (flags must precede the path)")
+		return exitUsage
+	}
+
+	plan, err := sync.ReadPlan(args[0])
+	if err != nil {
+		log.Printf("read plan: %v", err)
+		return exitFailure
+	}
+
+	gc, hasToken := newGitHubClient(ctx, hc)
+	if !hasToken {
+		log.Printf("github-token is required to apply a plan")
+		return exitUsage
+	}
+
+	current, err := currentIssues(ctx, gc, plan)
+	if err != nil {
+		log.Printf("issues: %v", err)
+		return exitFailure
+	}
+	if changes := plan.Changed(current); len(changes) > 0 {
+		for _, c := range changes {
+			log.Printf("changed since planning: %s", c)
+		}
+		log.Printf("refusing to apply a stale plan from %s: run plan again", plan.CreatedAt.Format(time.RFC3339))
+		return exitFailure
+	}
+
+	log.Printf("applying %d actions to %s ...", len(plan.Actions), plan.Repo)
+	if err := applyPlan(ctx, gc, plan); err != nil {
+		log.Printf("apply: %v", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// currentIssues returns the synced issues of the repository a plan applies to, along with any other issue the plan
+// was made from, such as those that lost their sync label
+func currentIssues(ctx context.Context, gc *github.Client, plan *sync.Plan) ([]*github.Issue, error) {
+	org, project, err := splitRepo(plan.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	issues, err := issue.Synced(ctx, gc, org, project)
+	if err != nil {
+		return nil, fmt.Errorf("synced: %w", err)
+	}
+
+	found := map[int]bool{}
+	for _, i := range issues {
+		found[i.GetNumber()] = true
+	}
+	for _, v := range plan.Issues {
+		if found[v.Number] {
+			continue
+		}
+		i, _, err := gc.Issues.Get(ctx, org, project, v.Number)
+		var ghErr *github.ErrorResponse
+		if errors.As(err, &ghErr) && (ghErr.Response.StatusCode == http.StatusNotFound || ghErr.Response.StatusCode == http.StatusGone) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get #%d: %w", v.Number, err)
+		}
+		issues = append(issues, i)
+	}
+	return issues, nil
+}
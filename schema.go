@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/chainguard-dev/secureframe-issue-sync/pkg/secureframe"
+)
+
+// runCheckSchema compares live GraphQL responses, and optionally the introspected schema, against what we expect.
+// It returns the exit code: non-zero if the schema appears to have drifted.
+func runCheckSchema(ctx context.Context, hc *http.Client) int {
+	sc := newGraphQLClient(hc)
+
+	var expected map[string]secureframe.Shape
+	if *expectedShapeFlag != "" {
+		bs, err := os.ReadFile(*expectedShapeFlag)
+		if err != nil {
+			log.Printf("read expected shape: %v", err)
+			return exitFailure
+		}
+		if err := json.Unmarshal(bs, &expected); err != nil {
+			log.Printf("parse expected shape: %v", err)
+			return exitFailure
+		}
+	}
+
+	reports, err := sc.CheckSchema(ctx, expected)
+	if err != nil {
+		log.Printf("check schema: %v", err)
+		return exitCode(err)
+	}
+
+	if *schemaSnapshotFlag != "" {
+		r, err := checkSnapshot(ctx, sc, *schemaSnapshotFlag)
+		if err != nil {
+			log.Printf("check introspection snapshot: %v", err)
+			return exitCode(err)
+		}
+		reports = append(reports, r)
+	}
+
+	ok := true
+	for _, r := range reports {
+		if !r.OK() {
+			ok = false
+		}
+	}
+
+	if *outputFlag == "json" {
+		bs, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Printf("marshal: %v", err)
+			return exitFailure
+		}
+		fmt.Println(string(bs))
+	} else {
+		for _, r := range reports {
+			if r.OK() {
+				fmt.Printf("%s: OK\n", r.Operation)
+				continue
+			}
+			fmt.Printf("%s: DRIFTED\n", r.Operation)
+			if s := r.Drift.String(); s != "" {
+				fmt.Println(s)
+			}
+			for _, e := range r.Errors {
+				fmt.Printf("error: %s\n", e)
+			}
+		}
+	}
+
+	if !ok {
+		log.Printf("Secureframe GraphQL schema has drifted from what secureframe-issue-sync expects")
+		return exitSchemaChange
+	}
+	return 0
+}
+
+// checkSnapshot compares the introspected schema against a stored snapshot, creating the snapshot if necessary
+func checkSnapshot(ctx context.Context, sc *secureframe.Client, path string) (secureframe.SchemaReport, error) {
+	r := secureframe.SchemaReport{Operation: "IntrospectionQuery"}
+
+	current, err := sc.Introspect(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || *updateSnapshotFlag {
+		log.Printf("writing introspection snapshot to %s", path)
+		return r, writeJSON(path, current)
+	}
+	if err != nil {
+		return r, fmt.Errorf("read: %w", err)
+	}
+
+	snapshot := secureframe.Shape{}
+	if err := json.Unmarshal(bs, &snapshot); err != nil {
+		return r, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	r.Drift = secureframe.CompareSnapshots(snapshot, current)
+	return r, nil
+}
+
+// writeJSON writes v to path as indented JSON
+func writeJSON(path string, v interface{}) error {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return os.WriteFile(path, append(bs, '\n'), 0o600)
+}